@@ -0,0 +1,134 @@
+package buffer
+
+import (
+	"sync/atomic"
+	"time"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* The background writer writes dirty, unpinned frames back ahead of eviction,
+* so RequestFree rarely has to write a dirty victim while holding muLookup.
+* Every BgWriterDelay it asks the replacer to write up to BgWriterMaxPages of
+* the frames it would evict first, like PostgreSQL's bgwriter.
+**/
+type bgWriter struct {
+	delay    atomic.Int64 // time.Duration between rounds
+	maxPages atomic.Int64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// bgWriterCounters outlive a writer, so stats add up across restarts.
+type bgWriterCounters struct {
+	rounds     atomic.Uint64
+	written    atomic.Uint64
+	maxWritten atomic.Uint64
+	errors     atomic.Uint64
+}
+
+// BgWriterStats counts the background writer's work, and the dirty victims
+// eviction still had to write back itself.
+type BgWriterStats struct {
+	Rounds         uint64 // rounds run
+	Written        uint64 // dirty pages written by the background writer
+	MaxWritten     uint64 // rounds that stopped at the page limit
+	Errors         uint64 // rounds that failed to write a page
+	DirtyEvictions uint64 // dirty victims written back by RequestFree
+}
+
+// StartBackgroundWriter starts writing dirty frames back at the rate set by
+// opts.BgWriterDelay and opts.BgWriterMaxPages. Close stops it.
+func (bp *BufferPool) StartBackgroundWriter(opts util.Options) error {
+	if bp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+	if opts.BgWriterDelay <= 0 || opts.BgWriterMaxPages <= 0 {
+		return util.ErrInvalidBgWriter
+	}
+
+	bp.muBgWriter.Lock()
+	defer bp.muBgWriter.Unlock()
+	if bp.bgWriter != nil {
+		return util.ErrBgWriterRunning
+	}
+
+	w := &bgWriter{stop: make(chan struct{}), done: make(chan struct{})}
+	w.delay.Store(int64(opts.BgWriterDelay))
+	w.maxPages.Store(int64(opts.BgWriterMaxPages))
+	bp.bgWriter = w
+	go w.run(bp)
+
+	return nil
+}
+
+// TuneBackgroundWriter changes the rate of the running writer from its next
+// round on. It fails with ErrBgWriterNotRunning if no writer runs.
+func (bp *BufferPool) TuneBackgroundWriter(delay time.Duration, maxPages int) error {
+	if delay <= 0 || maxPages <= 0 {
+		return util.ErrInvalidBgWriter
+	}
+
+	bp.muBgWriter.Lock()
+	defer bp.muBgWriter.Unlock()
+	if bp.bgWriter == nil {
+		return util.ErrBgWriterNotRunning
+	}
+	bp.bgWriter.delay.Store(int64(delay))
+	bp.bgWriter.maxPages.Store(int64(maxPages))
+
+	return nil
+}
+
+// StopBackgroundWriter stops the writer and waits for its current round.
+// Calling it without a running writer is a no-op.
+func (bp *BufferPool) StopBackgroundWriter() {
+	bp.muBgWriter.Lock()
+	w := bp.bgWriter
+	bp.bgWriter = nil
+	bp.muBgWriter.Unlock()
+
+	if w != nil {
+		close(w.stop)
+		<-w.done
+	}
+}
+
+func (bp *BufferPool) BgWriterStats() BgWriterStats {
+	return BgWriterStats{
+		Rounds:         bp.bgStats.rounds.Load(),
+		Written:        bp.bgStats.written.Load(),
+		MaxWritten:     bp.bgStats.maxWritten.Load(),
+		Errors:         bp.bgStats.errors.Load(),
+		DirtyEvictions: bp.rs.counters.dirtyEvictions.Load(),
+	}
+}
+
+func (w *bgWriter) run(bp *BufferPool) {
+	defer close(w.done)
+
+	timer := time.NewTimer(time.Duration(w.delay.Load()))
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-timer.C:
+		}
+
+		maxPages := int(w.maxPages.Load())
+		written, err := bp.replacer.WriteAhead(bp.fm, maxPages)
+		bp.bgStats.rounds.Add(1)
+		bp.bgStats.written.Add(uint64(written))
+		if written >= maxPages {
+			bp.bgStats.maxWritten.Add(1)
+		}
+		// A failed write leaves the frame dirty, eviction will report the error
+		if err != nil {
+			bp.bgStats.errors.Add(1)
+		}
+
+		timer.Reset(time.Duration(w.delay.Load()))
+	}
+}
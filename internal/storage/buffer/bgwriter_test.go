@@ -0,0 +1,71 @@
+package buffer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackgroundWriter(t *testing.T) {
+	t.Run("InvalidOptions", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 4, 4)
+		opts := util.DefaultOptions()
+
+		opts.BgWriterDelay = 0
+		assert.ErrorIs(t, sp.bp.StartBackgroundWriter(opts), util.ErrInvalidBgWriter, "zero delay")
+		opts = util.DefaultOptions()
+		opts.BgWriterMaxPages = 0
+		assert.ErrorIs(t, sp.bp.StartBackgroundWriter(opts), util.ErrInvalidBgWriter, "zero page limit")
+
+		assert.NoError(t, sp.bp.StartBackgroundWriter(util.DefaultOptions()), "start")
+		assert.ErrorIs(t, sp.bp.StartBackgroundWriter(util.DefaultOptions()), util.ErrBgWriterRunning, "second start")
+		assert.ErrorIs(t, sp.bp.TuneBackgroundWriter(0, 1), util.ErrInvalidBgWriter, "tune to zero delay")
+		sp.bp.StopBackgroundWriter()
+		sp.bp.StopBackgroundWriter()
+		assert.ErrorIs(t, sp.bp.TuneBackgroundWriter(time.Second, 1), util.ErrBgWriterNotRunning, "tune without a writer")
+		assert.NoError(t, sp.bp.StartBackgroundWriter(util.DefaultOptions()), "restart after stop")
+		assert.NoError(t, sp.bp.Close(), "close stops the writer")
+		assert.Nil(t, sp.bp.bgWriter, "writer stopped by close")
+		assert.ErrorIs(t, sp.bp.StartBackgroundWriter(util.DefaultOptions()), util.ErrBufferPoolClosed, "start after close")
+	})
+
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			sp := newSuitePool(t, factory, 4, 12)
+			opts := util.DefaultOptions()
+			opts.BgWriterDelay = time.Millisecond
+			opts.BgWriterMaxPages = 1
+			assert.NoError(t, sp.bp.StartBackgroundWriter(opts), "start")
+			defer sp.bp.StopBackgroundWriter()
+
+			for i := util.PageID(0); i < 4; i++ {
+				p, err := sp.bp.FetchPage(i)
+				assert.NoError(t, err, "fetch page %d", i)
+				copy(p.Data[:], []byte(fmt.Sprintf("bg %d", i)))
+				assert.NoError(t, sp.bp.Release(i, true), "release page %d", i)
+			}
+
+			assert.Eventually(t, func() bool {
+				return sp.bp.BgWriterStats().Written == 4
+			}, time.Second, time.Millisecond, "writer should clean every frame")
+			stats := sp.bp.BgWriterStats()
+			assert.GreaterOrEqual(t, stats.MaxWritten, uint64(1), "one page per round hits the limit")
+			assert.Equal(t, uint64(0), stats.Errors, "no write errors")
+
+			// Eviction now finds clean frames
+			assert.NoError(t, sp.bp.TuneBackgroundWriter(time.Hour, 1), "slow the writer down")
+			for i := util.PageID(4); i < 12; i++ {
+				_, err := sp.bp.FetchPage(i)
+				assert.NoError(t, err, "fetch page %d", i)
+				assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+			}
+			assert.Equal(t, uint64(0), sp.bp.BgWriterStats().DirtyEvictions, "no dirty victim left to eviction")
+			onDisk, err := sp.fm.ReadPage(2)
+			assert.NoError(t, err, "read page 2")
+			assert.Equal(t, []byte("bg 2"), onDisk.Data[:4], "page written by the background writer")
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSetPool(t *testing.T) {
+	t.Run("PagesOfSeveralFiles", func(t *testing.T) {
+		opts := util.DefaultOptions()
+		opts.BufferPoolSize = 2
+		opts.BufferPoolShards = 2
+		opts.MaxOpenFiles = 2
+		fs, err := file.NewFileSet(opts)
+		assert.NoError(t, err, "create file set")
+		t.Cleanup(func() { fs.Close() })
+		dir := t.TempDir()
+		for fileId := util.FileID(0); fileId < 3; fileId++ {
+			path := filepath.Join(dir, fmt.Sprintf("table-%d.dat", fileId))
+			assert.NoError(t, fs.Register(fileId, path, 4), "register file %d", fileId)
+		}
+		sbp, err := NewShardedBufferPool(fs, opts)
+		assert.NoError(t, err, "create sharded pool")
+
+		// Two pages per file through a two frame pool, so most are written back
+		var ids []util.PageID
+		for fileId := util.FileID(0); fileId < 3; fileId++ {
+			for range 2 {
+				p, err := sbp.NewPageIn(context.Background(), fileId)
+				assert.NoError(t, err, "new page in file %d", fileId)
+				assert.Equal(t, fileId, p.Header.PageID.FileID(), "page allocated in its file")
+				copy(p.Data[:], []byte(fmt.Sprintf("page %x", uint64(p.Header.PageID))))
+				ids = append(ids, p.Header.PageID)
+				assert.NoError(t, sbp.Release(p.Header.PageID, true))
+			}
+		}
+		assert.Equal(t, util.NewPageID(2, 1), ids[5], "files number their pages apart")
+		assert.LessOrEqual(t, fs.OpenFiles(), opts.MaxOpenFiles, "open files capped")
+
+		for _, pageId := range ids {
+			p, err := sbp.FetchPage(pageId)
+			assert.NoError(t, err, "fetch page %x", uint64(pageId))
+			want := fmt.Sprintf("page %x", uint64(pageId))
+			assert.Equal(t, []byte(want), p.Data[:len(want)], "page %x", uint64(pageId))
+			assert.NoError(t, sbp.Release(pageId, false))
+		}
+
+		_, err = sbp.NewPageIn(context.Background(), 3)
+		assert.ErrorIs(t, err, util.ErrUnknownFile, "unregistered file")
+		assert.NoError(t, sbp.Close(), "close pool")
+	})
+
+	t.Run("SingleFile", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 2, 2)
+		p, err := sp.bp.NewPageIn(context.Background(), 0)
+		assert.NoError(t, err, "file 0 is the file")
+		assert.Equal(t, util.PageID(2), p.Header.PageID, "allocated after the test pages")
+		assert.NoError(t, sp.bp.Release(p.Header.PageID, false))
+
+		_, err = sp.bp.NewPageIn(context.Background(), 1)
+		assert.ErrorIs(t, err, util.ErrUnknownFile, "no other file")
+	})
+}
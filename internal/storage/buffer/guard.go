@@ -0,0 +1,125 @@
+package buffer
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+// ReadPageGuard holds a pin and a shared latch on a page until Drop.
+type ReadPageGuard struct {
+	bp    *BufferPool
+	page  *page.Page
+	latch *sync.RWMutex
+}
+
+// WritePageGuard holds a pin and an exclusive latch on a page until Drop.
+// The page is released dirty if it was accessed through PageMut. The frame
+// version stays odd meanwhile, so optimistic reads of the page fail.
+// FlushPage, FlushAll and Close wait for the latch of a dirty page, so calling
+// them while holding a WritePageGuard on it deadlocks: Drop the guard first.
+type WritePageGuard struct {
+	bp    *BufferPool
+	page  *page.Page
+	latch *sync.RWMutex
+	desc  *FrameDesc
+	dirty bool
+}
+
+// FetchPageRead pins the page and takes its latch for reading.
+func (bp *BufferPool) FetchPageRead(pageId util.PageID) (*ReadPageGuard, error) {
+	p, desc, err := bp.fetchLatch(pageId)
+	if err != nil {
+		return nil, err
+	}
+
+	desc.latch.RLock()
+	return &ReadPageGuard{bp: bp, page: p, latch: &desc.latch}, nil
+}
+
+// FetchPageWrite pins the page and takes its latch for writing.
+func (bp *BufferPool) FetchPageWrite(pageId util.PageID) (*WritePageGuard, error) {
+	p, desc, err := bp.fetchLatch(pageId)
+	if err != nil {
+		return nil, err
+	}
+
+	desc.latch.Lock()
+	desc.version.Add(1)
+	return &WritePageGuard{bp: bp, page: p, latch: &desc.latch, desc: desc}, nil
+}
+
+// fetchLatch pins the page and returns its frame.
+func (bp *BufferPool) fetchLatch(pageId util.PageID) (*page.Page, *FrameDesc, error) {
+	p, err := bp.FetchPage(pageId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	desc, err := bp.rs.frameDesc(pageId)
+	if err != nil {
+		bp.Release(pageId, false)
+		return nil, nil, err
+	}
+
+	return p, desc, nil
+}
+
+func (g *ReadPageGuard) PageID() util.PageID {
+	return g.page.Header.PageID
+}
+
+// Page must not be modified through a read guard.
+func (g *ReadPageGuard) Page() *page.Page {
+	return g.page
+}
+
+// Drop releases the latch and the pin. Calling it again is a no-op.
+func (g *ReadPageGuard) Drop() error {
+	if g.page == nil {
+		return nil
+	}
+
+	pageId := g.page.Header.PageID
+	g.latch.RUnlock()
+	g.page, g.latch = nil, nil
+
+	return g.bp.Release(pageId, false)
+}
+
+func (g *WritePageGuard) PageID() util.PageID {
+	return g.page.Header.PageID
+}
+
+// Page gives read access without marking the page dirty.
+func (g *WritePageGuard) Page() *page.Page {
+	return g.page
+}
+
+// PageMut gives write access and marks the page dirty on Drop.
+func (g *WritePageGuard) PageMut() *page.Page {
+	g.dirty = true
+	return g.page
+}
+
+// Drop releases the latch and the pin, even if marking the page dirty fails.
+// Calling it again is a no-op.
+func (g *WritePageGuard) Drop() error {
+	if g.page == nil {
+		return nil
+	}
+
+	// Mark dirty before unlocking so a flush waiting on the latch sees it
+	pageId := g.page.Header.PageID
+	var err error
+	if g.dirty {
+		err = g.bp.replacer.MarkDirty(pageId)
+	}
+	g.desc.version.Add(1)
+	g.latch.Unlock()
+	g.page, g.latch, g.desc = nil, nil, nil
+
+	return errors.Join(err, g.bp.Release(pageId, false))
+}
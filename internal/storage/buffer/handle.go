@@ -0,0 +1,86 @@
+package buffer
+
+import (
+	"errors"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* FrameHandle is a swizzled reference to a page: the frame that held it and the
+* frame generation at that time. An index node can keep one per child it
+* visited and pin the child through it, skipping the pageToIdx lookup. It saves
+* the hashing, not the lock: FetchHandle still takes muLookup like GetPage, the
+* policy records the access under it. The generation moves whenever the frame
+* gets another page, so a handle outliving its page is detected and
+* FetchHandle falls back to a regular fetch. A page pinned through FetchHandle
+* can be released with ReleaseHandle, which skips the lookup and muLookup
+* altogether.
+**/
+type FrameHandle struct {
+	pageId     util.PageID
+	frameIdx   int
+	generation uint64
+	desc       *FrameDesc // the frame, for ReleaseHandle
+}
+
+func (h FrameHandle) PageID() util.PageID {
+	return h.pageId
+}
+
+// Handle returns a handle to a resident page, usually one the caller has
+// just fetched. It fails with ErrPageNotFound if the page is not resident.
+func (bp *BufferPool) Handle(pageId util.PageID) (FrameHandle, error) {
+	if bp.closed.Load() {
+		return FrameHandle{}, util.ErrBufferPoolClosed
+	}
+
+	return bp.rs.handle(pageId)
+}
+
+// FetchHandle pins the page of h like FetchPage. While its frame still holds
+// the page the lookup is skipped and h is returned as is. Otherwise the page is
+// fetched by id, loading it from disk if needed, and returned with a new
+// handle for the caller to keep.
+func (bp *BufferPool) FetchHandle(h FrameHandle) (*page.Page, FrameHandle, error) {
+	if bp.closed.Load() {
+		return nil, FrameHandle{}, util.ErrBufferPoolClosed
+	}
+
+	p, err := bp.replacer.PinHandle(h)
+	if err == nil {
+		bp.counters.handleHits.Add(1)
+		bp.trackPin(h.pageId)
+		return p, h, nil
+	}
+	// An evicting frame is stale too, its page may be loaded elsewhere
+	if !errors.Is(err, util.ErrStaleHandle) && !errors.Is(err, util.ErrPageEvicted) {
+		return nil, FrameHandle{}, err
+	}
+
+	bp.counters.staleHandles.Add(1)
+	p, err = bp.FetchPage(h.pageId)
+	if err != nil {
+		return nil, FrameHandle{}, err
+	}
+	// The page is pinned, so its frame cannot change before this lookup
+	fresh, err := bp.rs.handle(h.pageId)
+	if err != nil {
+		return nil, FrameHandle{}, errors.Join(err, bp.Release(h.pageId, false))
+	}
+
+	return p, fresh, nil
+}
+
+// ReleaseHandle is Release for a page pinned through the handle FetchHandle
+// returned. It fails with ErrStaleHandle if the frame no longer holds the page,
+// which means the caller did not hold a pin.
+func (bp *BufferPool) ReleaseHandle(h FrameHandle, isDirty bool) error {
+	if err := bp.rs.releaseHandle(h, isDirty); err != nil {
+		return err
+	}
+	bp.trackUnpin(h.pageId)
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameHandle(t *testing.T) {
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			t.Run("SkipsLookup", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 2, 2)
+				p, err := sp.bp.FetchPage(0)
+				assert.NoError(t, err, "fetch page 0")
+				h, err := sp.bp.Handle(0)
+				assert.NoError(t, err, "handle of page 0")
+				assert.Equal(t, util.PageID(0), h.PageID(), "handle page id")
+				assert.NoError(t, sp.bp.Release(0, false))
+
+				again, same, err := sp.bp.FetchHandle(h)
+				assert.NoError(t, err, "fetch through the handle")
+				assert.Same(t, p, again, "resident page")
+				assert.Equal(t, h, same, "handle still valid")
+				frameIdx, _ := sp.resident(0)
+				pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+				assert.Equal(t, int32(1), pinCount, "handle pins the page")
+				assert.NoError(t, sp.bp.ReleaseHandle(same, true), "release through the handle")
+				pinCount, _ = sp.replacer.GetPinCount(frameIdx)
+				assert.Equal(t, int32(0), pinCount, "handle released the pin")
+				assert.True(t, sp.shared.descs[frameIdx].dirty.Load(), "released dirty")
+				assert.ErrorIs(t, sp.bp.ReleaseHandle(FrameHandle{}, false), util.ErrStaleHandle, "zero handle")
+
+				stats := sp.bp.Stats()
+				assert.Equal(t, uint64(1), stats.HandleHits, "handle hit counted")
+				assert.Equal(t, uint64(0), stats.Hits, "no lookup")
+
+				_, err = sp.bp.Handle(1)
+				assert.ErrorIs(t, err, util.ErrPageNotFound, "no handle for a page that is not resident")
+			})
+
+			t.Run("FrameReused", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 1, 2)
+				_, err := sp.bp.FetchPage(0)
+				assert.NoError(t, err, "fetch page 0")
+				h0, _ := sp.bp.Handle(0)
+				assert.NoError(t, sp.bp.Release(0, false))
+
+				// Page 1 takes the only frame, then page 0 comes back into it
+				_, err = sp.bp.FetchPage(1)
+				assert.NoError(t, err, "fetch page 1")
+				h1, _ := sp.bp.Handle(1)
+				assert.Equal(t, h0.frameIdx, h1.frameIdx, "same frame")
+				assert.NoError(t, sp.bp.Release(1, false))
+				_, err = sp.bp.FetchPage(0)
+				assert.NoError(t, err, "fetch page 0 again")
+				assert.NoError(t, sp.bp.Release(0, false))
+
+				p, fresh, err := sp.bp.FetchHandle(h1)
+				assert.NoError(t, err, "stale handle falls back")
+				assert.Equal(t, util.PageID(1), p.Header.PageID, "page of the handle, not of the frame")
+				assert.NotEqual(t, h1, fresh, "new handle")
+				assert.NoError(t, sp.bp.Release(1, false))
+
+				p, fresh, err = sp.bp.FetchHandle(h0)
+				assert.NoError(t, err, "same page back in the same frame")
+				assert.Equal(t, util.PageID(0), p.Header.PageID, "correct page")
+				assert.NotEqual(t, h0.generation, fresh.generation, "generation moved")
+				assert.NoError(t, sp.bp.Release(0, false))
+				assert.Equal(t, uint64(2), sp.bp.Stats().StaleHandles, "stale handles counted")
+			})
+
+			t.Run("FrameRetired", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 2, 2)
+				var handles []FrameHandle
+				for i := util.PageID(0); i < 2; i++ {
+					_, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d", i)
+					h, _ := sp.bp.Handle(i)
+					handles = append(handles, h)
+					assert.NoError(t, sp.bp.Release(i, false))
+				}
+
+				assert.NoError(t, sp.bp.Resize(context.Background(), 1), "shrink")
+				for _, h := range handles {
+					p, fresh, err := sp.bp.FetchHandle(h)
+					assert.NoError(t, err, "fetch page %d through its handle", h.PageID())
+					assert.Equal(t, h.PageID(), p.Header.PageID, "correct page")
+					assert.Equal(t, 0, fresh.frameIdx, "only frame left")
+					assert.NoError(t, sp.bp.Release(h.PageID(), false))
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkFrameHandle compares a hit through the page id with one through a
+// handle, each followed by its release.
+func BenchmarkFrameHandle(b *testing.B) {
+	sbp, _ := newShardedTestPool(b, 64, 1, 64)
+	bp := sbp.shards[0]
+	handles := make([]FrameHandle, 64)
+	for i := range handles {
+		pageId := util.PageID(i)
+		if _, err := bp.FetchPage(pageId); err != nil {
+			b.Fatalf("fetch page %d: %v", i, err)
+		}
+		handles[i], _ = bp.Handle(pageId)
+		bp.Release(pageId, false)
+	}
+
+	b.Run("FetchPage", func(b *testing.B) {
+		for i := 0; b.Loop(); i++ {
+			pageId := util.PageID(i % 64)
+			bp.FetchPage(pageId)
+			bp.Release(pageId, false)
+		}
+	})
+
+	b.Run("FetchHandle", func(b *testing.B) {
+		for i := 0; b.Loop(); i++ {
+			h := handles[i%64]
+			bp.FetchHandle(h)
+			bp.ReleaseHandle(h, false)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package buffer
+
+import (
+	"errors"
+	"runtime"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+// OPTIMISTIC_READ_RETRIES is the number of optimistic attempts ReadOptimistic
+// makes before falling back to a read guard.
+const OPTIMISTIC_READ_RETRIES = 4
+
+/**
+* OptimisticRead reads a resident page without a pin or a latch, like the
+* optimistic latches of LeanStore and Umbra. It remembers the frame version and
+* Validate checks it did not move: no WritePageGuard was taken on the page and
+* the frame did not get another page meanwhile. Until then, what was read may be
+* torn or belong to an evicted page and must not be acted upon. The page header
+* flags change on pin and unpin without moving the version, read only the page
+* data. Readers overlapping a writer are data races to the race detector.
+**/
+type OptimisticRead struct {
+	desc    *FrameDesc
+	page    *page.Page
+	version uint64
+}
+
+// OptimisticRead starts an optimistic read of a resident page. It fails with
+// ErrPageNotFound on a miss, and with ErrPageWriteLatched while a writer holds
+// the page.
+func (bp *BufferPool) OptimisticRead(pageId util.PageID) (OptimisticRead, error) {
+	if bp.closed.Load() {
+		return OptimisticRead{}, util.ErrBufferPoolClosed
+	}
+
+	desc, p, version, err := bp.rs.optimisticFrame(pageId)
+	if err != nil {
+		return OptimisticRead{}, err
+	}
+	if version&1 == 1 {
+		return OptimisticRead{}, util.ErrPageWriteLatched
+	}
+
+	return OptimisticRead{desc: desc, page: p, version: version}, nil
+}
+
+func (r OptimisticRead) Page() *page.Page {
+	return r.page
+}
+
+// Validate reports whether the page is unchanged since OptimisticRead, so
+// everything read from it so far is consistent.
+func (r OptimisticRead) Validate() bool {
+	return r.desc.version.Load() == r.version
+}
+
+// ReadOptimistic runs read on the page without pinning or latching it, and
+// runs it again when a writer changed the page meanwhile. read must not keep
+// the page and must survive torn data, its result only counts once validated.
+// After OPTIMISTIC_READ_RETRIES failed attempts, or on a miss, read runs once
+// more under a read guard.
+func (bp *BufferPool) ReadOptimistic(pageId util.PageID, read func(p *page.Page) error) error {
+	for range OPTIMISTIC_READ_RETRIES {
+		r, err := bp.OptimisticRead(pageId)
+		if errors.Is(err, util.ErrPageWriteLatched) {
+			runtime.Gosched()
+			continue
+		}
+		if errors.Is(err, util.ErrPageNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		readErr := read(r.Page())
+		if r.Validate() {
+			bp.counters.optimisticReads.Add(1)
+			return readErr
+		}
+	}
+
+	bp.counters.optimisticFallbacks.Add(1)
+	guard, err := bp.FetchPageRead(pageId)
+	if err != nil {
+		return err
+	}
+	defer guard.Drop()
+
+	return read(guard.Page())
+}
@@ -0,0 +1,124 @@
+package buffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimisticRead(t *testing.T) {
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			t.Run("ValidWithoutWriter", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 2, 2)
+				_, err := sp.bp.FetchPage(0)
+				assert.NoError(t, err, "fetch page 0")
+				assert.NoError(t, sp.bp.Release(0, false))
+
+				r, err := sp.bp.OptimisticRead(0)
+				assert.NoError(t, err, "optimistic read")
+				assert.Equal(t, []byte("Page 0 test data"), r.Page().Data[:16], "page data")
+				frameIdx, _ := sp.resident(0)
+				pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+				assert.Equal(t, int32(0), pinCount, "no pin taken")
+
+				guard, err := sp.bp.FetchPageRead(0)
+				assert.NoError(t, err, "read guard")
+				assert.NoError(t, guard.Drop())
+				assert.True(t, r.Validate(), "readers do not invalidate")
+
+				_, err = sp.bp.OptimisticRead(1)
+				assert.ErrorIs(t, err, util.ErrPageNotFound, "miss")
+			})
+
+			t.Run("WriterInvalidates", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 2, 2)
+				_, err := sp.bp.FetchPage(0)
+				assert.NoError(t, err, "fetch page 0")
+				assert.NoError(t, sp.bp.Release(0, false))
+
+				r, err := sp.bp.OptimisticRead(0)
+				assert.NoError(t, err, "optimistic read")
+				guard, err := sp.bp.FetchPageWrite(0)
+				assert.NoError(t, err, "write guard")
+				_, err = sp.bp.OptimisticRead(0)
+				assert.ErrorIs(t, err, util.ErrPageWriteLatched, "page latched for writing")
+				assert.False(t, r.Validate(), "writer holding the latch")
+				assert.NoError(t, guard.Drop())
+				assert.False(t, r.Validate(), "writer came and went")
+
+				r, err = sp.bp.OptimisticRead(0)
+				assert.NoError(t, err, "read after the writer")
+				assert.True(t, r.Validate(), "new read is valid")
+			})
+
+			t.Run("EvictionInvalidates", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 1, 2)
+				_, err := sp.bp.FetchPage(0)
+				assert.NoError(t, err, "fetch page 0")
+				assert.NoError(t, sp.bp.Release(0, false))
+
+				r, err := sp.bp.OptimisticRead(0)
+				assert.NoError(t, err, "optimistic read")
+				_, err = sp.bp.FetchPage(1)
+				assert.NoError(t, err, "fetch page 1 into the same frame")
+				assert.False(t, r.Validate(), "frame holds another page")
+				assert.NoError(t, sp.bp.Release(1, false))
+			})
+		})
+	}
+
+	t.Run("ReadOptimisticRetries", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 2, 2)
+		_, err := sp.bp.FetchPage(0)
+		assert.NoError(t, err, "fetch page 0")
+		assert.NoError(t, sp.bp.Release(0, false))
+
+		calls := 0
+		err = sp.bp.ReadOptimistic(0, func(p *page.Page) error {
+			calls++
+			if calls == 1 {
+				// A writer slips in during the first attempt
+				guard, err := sp.bp.FetchPageWrite(0)
+				assert.NoError(t, err, "write guard")
+				copy(guard.PageMut().Data[:], []byte("rewritten"))
+				assert.NoError(t, guard.Drop())
+				return nil
+			}
+			assert.Equal(t, []byte("rewritten"), p.Data[:9], "second attempt sees the write")
+			return nil
+		})
+		assert.NoError(t, err, "read optimistic")
+		assert.Equal(t, 2, calls, "read ran again after the invalidation")
+		assert.Equal(t, uint64(1), sp.bp.Stats().OptimisticReads, "validated read counted")
+	})
+
+	t.Run("ReadOptimisticFallsBack", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 2, 2)
+
+		var data []byte
+		err := sp.bp.ReadOptimistic(1, func(p *page.Page) error {
+			data = append([]byte(nil), p.Data[:16]...)
+			return nil
+		})
+		assert.NoError(t, err, "read a page that is not resident")
+		assert.Equal(t, []byte("Page 1 test data"), data, "page loaded through the read guard")
+		frameIdx, exist := sp.resident(1)
+		assert.True(t, exist, "page left resident")
+		pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+		assert.Equal(t, int32(0), pinCount, "read guard dropped")
+
+		// A writer holding the latch throughout makes every attempt fail
+		guard, err := sp.bp.FetchPageWrite(1)
+		assert.NoError(t, err, "write guard")
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			guard.Drop()
+		}()
+		assert.NoError(t, sp.bp.ReadOptimistic(1, func(p *page.Page) error { return nil }), "read after the writer")
+		assert.Equal(t, uint64(2), sp.bp.Stats().OptimisticFallbacks, "both reads took a read guard")
+	})
+}
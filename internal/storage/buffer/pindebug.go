@@ -0,0 +1,223 @@
+package buffer
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+// PIN_STACK_DEPTH is the number of stack frames recorded per pin.
+const PIN_STACK_DEPTH = 16
+
+/**
+* pinTracker is the pin debug mode. Every pin handed to a caller records the
+* time and the caller's stack, and Release drops a record of the page. Release
+* does not say which pin it drops, so the newest record goes: a leaked pin is
+* usually the oldest one still held. Only program counters are recorded, they
+* are turned into file:line when a leak is reported.
+**/
+type pinTracker struct {
+	mu     sync.Mutex
+	pins   map[util.PageID][]*pinRecord
+	maxAge time.Duration
+	report func(PinLeak)
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type pinRecord struct {
+	at       time.Time
+	pcs      [PIN_STACK_DEPTH]uintptr
+	depth    int
+	reported bool
+}
+
+// PinLeak is a pin still held, with the stack of the caller that took it.
+type PinLeak struct {
+	PageID   util.PageID
+	PinnedAt time.Time
+	Stack    string
+}
+
+func (l PinLeak) String() string {
+	return fmt.Sprintf("page %d pinned since %s by:\n%s", l.PageID, l.PinnedAt.Format(time.RFC3339Nano), l.Stack)
+}
+
+// EnablePinDebug records the caller's stack at every pin. With maxAge > 0,
+// every pin held longer than maxAge is passed to report once. Close reports
+// the pins still held and fails with ErrPinLeak. A maxAge of 0 only checks at
+// Close, and report may then be nil.
+func (bp *BufferPool) EnablePinDebug(maxAge time.Duration, report func(PinLeak)) error {
+	if bp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+	if maxAge < 0 || (maxAge > 0 && report == nil) {
+		return util.ErrInvalidPinDebug
+	}
+
+	t := &pinTracker{
+		pins:   make(map[util.PageID][]*pinRecord),
+		maxAge: maxAge,
+		report: report,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if !bp.pinDebug.CompareAndSwap(nil, t) {
+		return util.ErrPinDebugEnabled
+	}
+	if maxAge > 0 {
+		go t.run()
+	} else {
+		close(t.done)
+	}
+
+	return nil
+}
+
+// disablePinDebug drops the pin tracker and stops its age checks.
+func (bp *BufferPool) disablePinDebug() {
+	t := bp.pinDebug.Swap(nil)
+	if t != nil && t.maxAge > 0 {
+		close(t.stop)
+		<-t.done
+	}
+}
+
+// PinLeaks returns every pin taken since EnablePinDebug and not released yet,
+// oldest first.
+func (bp *BufferPool) PinLeaks() []PinLeak {
+	if t := bp.pinDebug.Load(); t != nil {
+		return t.leaks(0, false)
+	}
+	return nil
+}
+
+// trackPin records a pin handed to the caller of a pool method.
+func (bp *BufferPool) trackPin(pageId util.PageID) {
+	if t := bp.pinDebug.Load(); t != nil {
+		t.pin(pageId)
+	}
+}
+
+func (bp *BufferPool) trackUnpin(pageId util.PageID) {
+	if t := bp.pinDebug.Load(); t != nil {
+		t.unpin(pageId)
+	}
+}
+
+// checkPinLeaks stops the age checks and reports the pins still held.
+func (bp *BufferPool) checkPinLeaks() error {
+	t := bp.pinDebug.Load()
+	if t == nil {
+		return nil
+	}
+
+	if t.maxAge > 0 {
+		close(t.stop)
+		<-t.done
+	}
+	// Report the pins the age checks have not, and fail with all of them
+	t.leaks(0, true)
+	leaks := t.leaks(0, false)
+	if len(leaks) == 0 {
+		return nil
+	}
+
+	lines := make([]string, len(leaks))
+	for i, leak := range leaks {
+		lines[i] = leak.String()
+	}
+	return fmt.Errorf("%w: %d pins\n%s", util.ErrPinLeak, len(leaks), strings.Join(lines, "\n"))
+}
+
+func (t *pinTracker) pin(pageId util.PageID) {
+	// Skip runtime.Callers, pin and trackPin, the stack starts at the pool method
+	r := &pinRecord{at: time.Now()}
+	r.depth = runtime.Callers(3, r.pcs[:])
+
+	t.mu.Lock()
+	t.pins[pageId] = append(t.pins[pageId], r)
+	t.mu.Unlock()
+}
+
+func (t *pinTracker) unpin(pageId util.PageID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Pins taken before EnablePinDebug have no record
+	records := t.pins[pageId]
+	if len(records) == 0 {
+		return
+	}
+	if len(records) == 1 {
+		delete(t.pins, pageId)
+		return
+	}
+	t.pins[pageId] = records[:len(records)-1]
+}
+
+// leaks returns the pins older than minAge, oldest first. With onlyNew set it
+// skips and marks the ones already passed to report, and reports the others.
+func (t *pinTracker) leaks(minAge time.Duration, onlyNew bool) []PinLeak {
+	now := time.Now()
+	var leaks []PinLeak
+
+	t.mu.Lock()
+	for pageId, records := range t.pins {
+		for _, r := range records {
+			if now.Sub(r.at) < minAge || (onlyNew && r.reported) {
+				continue
+			}
+			if onlyNew {
+				r.reported = true
+			}
+			leaks = append(leaks, PinLeak{PageID: pageId, PinnedAt: r.at, Stack: formatStack(r.pcs[:r.depth])})
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(leaks, func(a, b int) bool {
+		return leaks[a].PinnedAt.Before(leaks[b].PinnedAt)
+	})
+	if onlyNew && t.report != nil {
+		for _, leak := range leaks {
+			t.report(leak)
+		}
+	}
+
+	return leaks
+}
+
+// run reports pins older than maxAge, checking twice per maxAge.
+func (t *pinTracker) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(max(t.maxAge/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.leaks(t.maxAge, true)
+		}
+	}
+}
+
+func formatStack(pcs []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
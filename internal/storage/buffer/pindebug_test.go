@@ -0,0 +1,106 @@
+package buffer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// leakPage fetches a page and never releases it.
+func leakPage(t *testing.T, bp *BufferPool, pageId util.PageID) {
+	_, err := bp.FetchPage(pageId)
+	assert.NoError(t, err, "fetch page %d", pageId)
+}
+
+func TestPinDebug(t *testing.T) {
+	t.Run("InvalidOptions", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 4, 4)
+		assert.ErrorIs(t, sp.bp.EnablePinDebug(-time.Second, nil), util.ErrInvalidPinDebug, "negative age")
+		assert.ErrorIs(t, sp.bp.EnablePinDebug(time.Second, nil), util.ErrInvalidPinDebug, "age without report")
+		assert.NoError(t, sp.bp.EnablePinDebug(0, nil), "check at Close only")
+		assert.ErrorIs(t, sp.bp.EnablePinDebug(0, nil), util.ErrPinDebugEnabled, "enabled twice")
+	})
+
+	t.Run("ShardedAllOrNone", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 8, 4, 8)
+		assert.NoError(t, sbp.shards[2].EnablePinDebug(0, nil), "enable one shard")
+		err := sbp.EnablePinDebug(time.Hour, func(PinLeak) {})
+		assert.ErrorIs(t, err, util.ErrPinDebugEnabled, "one shard already enabled")
+		for i := range 2 {
+			assert.Nil(t, sbp.shards[i].pinDebug.Load(), "shard %d rolled back", i)
+		}
+
+		assert.NoError(t, sbp.Close(), "close")
+		assert.ErrorIs(t, sbp.EnablePinDebug(0, nil), util.ErrBufferPoolClosed, "enable after close")
+	})
+
+	t.Run("ReleasedPinsForgotten", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 4, 4)
+		assert.NoError(t, sp.bp.EnablePinDebug(0, nil))
+
+		_, err := sp.bp.FetchPage(0)
+		assert.NoError(t, err, "fetch page 0")
+		_, err = sp.bp.GetPage(0)
+		assert.NoError(t, err, "hit page 0")
+		guard, err := sp.bp.FetchPageRead(1)
+		assert.NoError(t, err, "read guard on page 1")
+		newPage, err := sp.bp.NewPage()
+		assert.NoError(t, err, "new page")
+		assert.Len(t, sp.bp.PinLeaks(), 4, "every pin recorded")
+
+		assert.NoError(t, sp.bp.Release(0, false))
+		assert.NoError(t, sp.bp.Release(0, false))
+		assert.NoError(t, guard.Drop())
+		assert.NoError(t, sp.bp.Release(newPage.Header.PageID, false))
+		assert.Empty(t, sp.bp.PinLeaks(), "every pin released")
+		assert.NoError(t, sp.bp.Close(), "no leak at Close")
+	})
+
+	t.Run("LeakReportedAtClose", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 4, 4)
+		assert.NoError(t, sp.bp.EnablePinDebug(0, nil))
+
+		leakPage(t, sp.bp, 2)
+		_, err := sp.bp.FetchPage(3)
+		assert.NoError(t, err, "fetch page 3")
+		assert.NoError(t, sp.bp.Release(3, false))
+
+		leaks := sp.bp.PinLeaks()
+		assert.Len(t, leaks, 1, "one pin held")
+		assert.Equal(t, util.PageID(2), leaks[0].PageID, "leaked page")
+		assert.Contains(t, leaks[0].Stack, "buffer.leakPage", "stack names the caller that pinned")
+		assert.Contains(t, leaks[0].Stack, "pindebug_test.go", "stack has file positions")
+
+		err = sp.bp.Close()
+		assert.ErrorIs(t, err, util.ErrPinLeak, "Close reports the leak")
+		assert.ErrorContains(t, err, "buffer.leakPage", "error carries the stack")
+	})
+
+	t.Run("LeakReportedAfterAge", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 4, 4)
+		var mu sync.Mutex
+		var reported []PinLeak
+		assert.NoError(t, sp.bp.EnablePinDebug(10*time.Millisecond, func(leak PinLeak) {
+			mu.Lock()
+			reported = append(reported, leak)
+			mu.Unlock()
+		}))
+
+		leakPage(t, sp.bp, 1)
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(reported) == 1
+		}, time.Second, 5*time.Millisecond, "old pin reported")
+		time.Sleep(30 * time.Millisecond)
+
+		assert.ErrorIs(t, sp.bp.Close(), util.ErrPinLeak, "Close still fails")
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(t, reported, 1, "each pin reported once")
+		assert.Equal(t, util.PageID(1), reported[0].PageID, "reported page")
+	})
+}
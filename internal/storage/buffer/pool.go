@@ -1,6 +1,12 @@
 package buffer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
 	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
 	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
 	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
@@ -8,17 +14,38 @@ import (
 
 // BufferPool manages the buffer pool with a pluggable replacer.
 type BufferPool struct {
-	fm       *file.FileManager // File manager for I/O
+	fm       file.PageStore // File manager, or file set, for I/O
 	rs       *ReplacerShared
 	replacer Replacer // Pluggable replacement policy
+
+	loading   map[util.PageID]*pageLoad // In-flight disk reads started by FetchPage or Prefetch
+	muLoading sync.Mutex
+	closed    atomic.Bool
+
+	readAhead   atomic.Pointer[readAhead]  // nil unless EnableReadAhead was called
+	prefetching sync.WaitGroup             // Prefetch goroutines in flight
+	pinDebug    atomic.Pointer[pinTracker] // nil unless EnablePinDebug was called
+
+	bgWriter   *bgWriter // nil unless StartBackgroundWriter was called
+	muBgWriter sync.Mutex
+	bgStats    bgWriterCounters
+
+	counters poolCounters
+}
+
+// pageLoad is a single disk read shared by every FetchPage that missed on the same page.
+type pageLoad struct {
+	done chan struct{}
+	err  error
 }
 
 // NewBufferPool initializes the buffer pool with a replacer.
-func NewBufferPool(fm *file.FileManager, replacer Replacer, shared *ReplacerShared) *BufferPool {
+func NewBufferPool(fm file.PageStore, replacer Replacer, shared *ReplacerShared) *BufferPool {
 	bp := &BufferPool{
 		fm:       fm,
 		rs:       shared,
 		replacer: replacer,
+		loading:  make(map[util.PageID]*pageLoad),
 	}
 
 	return bp
@@ -26,26 +53,295 @@ func NewBufferPool(fm *file.FileManager, replacer Replacer, shared *ReplacerShar
 
 // AllocateFrame delegates eviction to the replacer.
 func (bp *BufferPool) AllocateFrame(pageId util.PageID) (*page.Page, error) {
-	// Page not in buffer, need to load from disk
-	readPage, err := bp.fm.ReadPage(pageId)
+	p, err := bp.allocateFrame(context.Background(), pageId, bp.fm, nil)
+	if err == nil {
+		bp.trackPin(pageId)
+	}
+
+	return p, err
+}
+
+func (bp *BufferPool) allocateFrame(ctx context.Context, pageId util.PageID, src PageSource, strategy *AccessStrategy) (*page.Page, error) {
+	if bp.closed.Load() {
+		return nil, util.ErrBufferPoolClosed
+	}
+
+	// Page not in buffer, read it from disk straight into a frame and pin it
+	return bp.requestFree(ctx, pageId, src, strategy)
+}
+
+func (bp *BufferPool) requestFree(ctx context.Context, pageId util.PageID, src PageSource, strategy *AccessStrategy) (*page.Page, error) {
+	if strategy == nil {
+		return bp.replacer.RequestFree(ctx, pageId, src, bp.fm)
+	}
+
+	return strategy.requestFree(ctx, bp, pageId, src)
+}
+
+// NewPage allocates a fresh page id and places a zeroed page for it in a frame
+// without reading from disk. The page is returned pinned and dirty, so the
+// caller must Release it like any other page. While every frame is pinned it
+// waits for an unpin, see NewPageContext.
+func (bp *BufferPool) NewPage() (*page.Page, error) {
+	return bp.NewPageWith(context.Background(), nil)
+}
+
+// NewPageContext is NewPage giving up with ErrNoFreeFrame once ctx is done.
+func (bp *BufferPool) NewPageContext(ctx context.Context) (*page.Page, error) {
+	return bp.NewPageWith(ctx, nil)
+}
+
+// NewPageWith is NewPageContext placing the page through an access strategy,
+// for bulk loads. A nil strategy uses the whole pool.
+func (bp *BufferPool) NewPageWith(ctx context.Context, strategy *AccessStrategy) (*page.Page, error) {
+	if bp.closed.Load() {
+		return nil, util.ErrBufferPoolClosed
+	}
+
+	pageId, err := bp.fm.AllocatePage()
 	if err != nil {
 		return nil, err
 	}
 
-	// Get the page into buffer and pin it
-	if err := bp.replacer.RequestFree(readPage, bp.fm); err != nil {
+	return bp.newPageAt(ctx, pageId, strategy)
+}
+
+// NewPageIn is NewPageContext allocating the page in one file of the file set
+// the pool runs on. A pool on a single file only has file 0.
+func (bp *BufferPool) NewPageIn(ctx context.Context, fileId util.FileID) (*page.Page, error) {
+	if bp.closed.Load() {
+		return nil, util.ErrBufferPoolClosed
+	}
+
+	pageId, err := allocatePageIn(bp.fm, fileId)
+	if err != nil {
 		return nil, err
 	}
 
-	return readPage, nil
+	return bp.newPageAt(ctx, pageId, nil)
 }
 
-// Get and pin page
+func allocatePageIn(fm file.PageStore, fileId util.FileID) (util.PageID, error) {
+	if fs, ok := fm.(*file.FileSet); ok {
+		return fs.AllocatePageIn(fileId)
+	}
+	if fileId != 0 {
+		return 0, fmt.Errorf("%w: file %d", util.ErrUnknownFile, fileId)
+	}
+
+	return fm.AllocatePage()
+}
+
+// newPageAt places a zeroed page for an id already allocated in the file. On
+// failure the id goes back to the file, so failed calls do not use up ids.
+func (bp *BufferPool) newPageAt(ctx context.Context, pageId util.PageID, strategy *AccessStrategy) (*page.Page, error) {
+	newPage, err := bp.requestFree(ctx, pageId, newPages{}, strategy)
+	if err != nil {
+		return nil, errors.Join(err, bp.fm.DeallocatePage(pageId))
+	}
+
+	// Never written to disk yet, so eviction must write it back
+	if err := bp.replacer.MarkDirty(pageId); err != nil {
+		// Drop the frame first, a reused id must not find the old one
+		return nil, errors.Join(err, bp.replacer.Unpin(pageId, false), bp.replacer.DeletePage(pageId), bp.fm.DeallocatePage(pageId))
+	}
+	bp.counters.newPages.Add(1)
+	bp.trackPin(pageId)
+
+	return newPage, nil
+}
+
+// FetchPage returns the page pinned, loading it from disk on a miss. Concurrent
+// misses on the same page share one disk read instead of each reading the page.
+// While every frame is pinned a miss waits for an unpin, see FetchPageContext.
+func (bp *BufferPool) FetchPage(pageId util.PageID) (*page.Page, error) {
+	return bp.FetchPageWith(context.Background(), pageId, nil)
+}
+
+// FetchPageContext is FetchPage giving up with ErrNoFreeFrame once ctx is done,
+// or with ctx.Err() while it waits for another caller loading the page.
+func (bp *BufferPool) FetchPageContext(ctx context.Context, pageId util.PageID) (*page.Page, error) {
+	return bp.FetchPageWith(ctx, pageId, nil)
+}
+
+// FetchPageWith is FetchPageContext loading misses through an access strategy,
+// so a scan reuses its own ring of frames. Hits pin the resident page as usual.
+// A nil strategy uses the whole pool.
+func (bp *BufferPool) FetchPageWith(ctx context.Context, pageId util.PageID, strategy *AccessStrategy) (*page.Page, error) {
+	if bp.closed.Load() {
+		return nil, util.ErrBufferPoolClosed
+	}
+	bp.readAheadOf(pageId, strategy)
+
+	p, err := bp.fetchPage(ctx, pageId, strategy)
+	if err == nil {
+		bp.trackPin(pageId)
+	}
+
+	return p, err
+}
+
+func (bp *BufferPool) fetchPage(ctx context.Context, pageId util.PageID, strategy *AccessStrategy) (*page.Page, error) {
+	for {
+		p, err := bp.replacer.GetPage(pageId)
+		if err == nil {
+			bp.counters.hits.Add(1)
+			return p, nil
+		}
+		if !errors.Is(err, util.ErrPageNotFound) && !errors.Is(err, util.ErrPageEvicted) {
+			return nil, err
+		}
+
+		bp.muLoading.Lock()
+		if load, ok := bp.loading[pageId]; ok {
+			bp.muLoading.Unlock()
+			bp.counters.loadWaits.Add(1)
+			select {
+			case <-load.done:
+			case <-ctx.Done():
+				// Not a frame shortage, the load may still succeed for the others
+				return nil, ctx.Err()
+			}
+			// The leader's own deadline says nothing about ours, try again
+			if load.err != nil && !isContextErr(load.err) {
+				return nil, load.err
+			}
+			// Loaded by another caller, pin it through GetPage
+			continue
+		}
+
+		// A load may have finished between GetPage and taking muLoading
+		if p, err := bp.replacer.GetPage(pageId); err == nil {
+			bp.muLoading.Unlock()
+			bp.counters.hits.Add(1)
+			return p, nil
+		}
+
+		load := &pageLoad{done: make(chan struct{})}
+		bp.loading[pageId] = load
+		bp.muLoading.Unlock()
+		bp.counters.misses.Add(1)
+
+		return bp.loadPage(ctx, pageId, bp.fm, strategy, load)
+	}
+}
+
+// loadPage reads the page into a frame for a load registered in bp.loading,
+// then wakes the callers waiting on it.
+func (bp *BufferPool) loadPage(ctx context.Context, pageId util.PageID, src PageSource, strategy *AccessStrategy, load *pageLoad) (*page.Page, error) {
+	p, err := bp.allocateFrame(ctx, pageId, src, strategy)
+	load.err = err
+
+	bp.muLoading.Lock()
+	delete(bp.loading, pageId)
+	bp.muLoading.Unlock()
+	close(load.done)
+
+	return p, err
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Get and pin page, counted as a hit when resident
 func (bp *BufferPool) GetPage(pageId util.PageID) (*page.Page, error) {
-	return bp.replacer.GetPage(pageId)
+	if bp.closed.Load() {
+		return nil, util.ErrBufferPoolClosed
+	}
+
+	p, err := bp.replacer.GetPage(pageId)
+	if err == nil {
+		bp.counters.hits.Add(1)
+		bp.trackPin(pageId)
+	}
+
+	return p, err
 }
 
 // UnpinFrame delegates to replacer.
 func (bp *BufferPool) Release(pageId util.PageID, isDirty bool) error {
-	return bp.replacer.Unpin(pageId, isDirty)
+	if err := bp.replacer.Unpin(pageId, isDirty); err != nil {
+		return err
+	}
+	bp.trackUnpin(pageId)
+
+	return nil
+}
+
+// FlushPage writes the page back through the file manager if it is dirty.
+func (bp *BufferPool) FlushPage(pageId util.PageID) error {
+	if bp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+
+	return bp.replacer.FlushPage(pageId, bp.fm)
+}
+
+// Resize grows or shrinks the pool to newSize frames while it serves requests.
+// Shrinking retires the last frames once their pages are unpinned, writing
+// dirty pages back first. If ctx ends while a page is still pinned, Resize
+// fails with ErrPagePinned and the pool keeps the frames not retired yet.
+func (bp *BufferPool) Resize(ctx context.Context, newSize int) error {
+	if bp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+
+	return bp.replacer.Resize(ctx, newSize, bp.fm)
+}
+
+// FlushAll writes back every dirty frame, pinned or not.
+func (bp *BufferPool) FlushAll() error {
+	if bp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+
+	return bp.replacer.FlushAll(bp.fm)
+}
+
+// DeletePage drops the page from the pool and returns it to the file's free
+// list. It fails with ErrPagePinned while anyone still holds the page, or is
+// loading it. Misses wait on muLoading until the page is freed, so none can
+// bring it back in between and leave a stale frame for NewPage to reuse.
+func (bp *BufferPool) DeletePage(pageId util.PageID) error {
+	if bp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+
+	bp.muLoading.Lock()
+	defer bp.muLoading.Unlock()
+	if _, ok := bp.loading[pageId]; ok {
+		return fmt.Errorf("%w: page %d is being loaded", util.ErrPagePinned, pageId)
+	}
+
+	if err := bp.replacer.DeletePage(pageId); err != nil && !errors.Is(err, util.ErrPageNotFound) {
+		return err
+	}
+
+	return bp.fm.DeallocatePage(pageId)
+}
+
+// Close flushes every dirty frame and syncs the file. Afterwards the pool
+// refuses new work, only Release is still accepted for pages pinned before.
+// The file manager is owned by the caller and stays open. In pin debug mode it
+// fails with ErrPinLeak if pages are still pinned, after closing.
+func (bp *BufferPool) Close() error {
+	if !bp.closed.CompareAndSwap(false, true) {
+		return nil // Idempotent
+	}
+
+	bp.StopBackgroundWriter()
+	// Prefetch checks closed under muLoading, none can start after this
+	bp.muLoading.Lock()
+	bp.muLoading.Unlock()
+	bp.prefetching.Wait()
+
+	if err := bp.replacer.FlushAll(bp.fm); err != nil {
+		return err
+	}
+	if err := bp.fm.Sync(); err != nil {
+		return err
+	}
+
+	return bp.checkPinLeaks()
 }
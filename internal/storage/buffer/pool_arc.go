@@ -0,0 +1,325 @@
+package buffer
+
+import (
+	"container/list"
+	"context"
+	"iter"
+	"slices"
+	"sync/atomic"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* ARC (Adaptive Replacement Cache, Megiddo & Modha) splits resident frames into
+* t1 (seen once recently) and t2 (seen at least twice). Pages evicted from each
+* side are remembered by id in the ghost lists b1 and b2. A miss that hits b1
+* means t1 was too small, a miss that hits b2 means t2 was too small, and the
+* target size of t1 moves accordingly, so the pool adapts between recency-heavy
+* and frequency-heavy workloads. Pinned frames are skipped when evicting.
+**/
+type ARCDesc struct {
+	FrameDesc
+	elem *list.Element // position in t1 or t2 while resident
+	inT2 bool
+}
+
+type ARCReplacer struct {
+	frames []*ARCDesc
+	*ReplacerShared
+	target int        // adaptive target size of t1
+	t1, t2 *list.List // resident frame indexes, MRU at front
+	b1, b2 *list.List // ghost page ids evicted from t1 / t2, MRU at front
+	ghosts map[util.PageID]*list.Element
+}
+
+type arcGhost struct {
+	pageId util.PageID
+	inB2   bool
+}
+
+func (this *ARCReplacer) Init(size int, replacerShared *ReplacerShared) {
+	this.frames = make([]*ARCDesc, size)
+	this.ReplacerShared = replacerShared
+	this.target = 0
+	this.t1, this.t2 = list.New(), list.New()
+	this.b1, this.b2 = list.New(), list.New()
+	this.ghosts = make(map[util.PageID]*list.Element)
+
+	for i := 0; i < size; i++ {
+		this.frames[i] = &ARCDesc{}
+		this.descs[i] = &this.frames[i].FrameDesc
+	}
+}
+
+func (this *ARCReplacer) RequestFree(ctx context.Context, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	return this.sweepUntilFree(ctx, func() (*page.Page, error) {
+		return this.sweep(pageId, src, fm)
+	})
+}
+
+// sweep places pageId in a victim frame, or fails with ErrNoFreeFrame if every
+// frame is pinned.
+func (this *ARCReplacer) sweep(pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	this.muLookup.Lock()
+	defer this.muLookup.Unlock()
+
+	// Another caller loaded the same page first, share its frame
+	if p, found, err := this.shareLoaded(pageId, this.pin); found {
+		return p, err
+	}
+
+	// A ghost hit tells which side was evicted too early
+	ghostElem, wasGhost := this.ghosts[pageId]
+	inB2 := wasGhost && ghostElem.Value.(arcGhost).inB2
+	target := this.target
+	if wasGhost {
+		target = this.adapt(inB2)
+	}
+
+	frameIdx := this.findVictim(inB2, target)
+	if frameIdx < 0 {
+		return nil, util.ErrNoFreeFrame
+	}
+
+	// Pins only grow under muLookup, so an unpinned victim stays unpinned
+	if !this.claimVictim(frameIdx) {
+		return nil, util.ErrInvalidEviction
+	}
+	desc := this.frames[frameIdx]
+	// Only now, a sweep retried after finding every frame pinned adapts once
+	this.target = target
+
+	// The frame's page is overwritten in place, keep the id of the evicted one
+	evicted := desc.page.Load() != nil
+	evictedId := desc.buf.Header.PageID
+	page, err := this.installPage(frameIdx, pageId, src, fm)
+	if err != nil {
+		return nil, err
+	}
+
+	if evicted {
+		this.remember(desc, evictedId)
+	}
+
+	// Ghosts may have been trimmed while installPage released muLookup
+	ghostElem, wasGhost = this.ghosts[pageId]
+	if wasGhost {
+		this.forget(ghostElem)
+		desc.elem, desc.inT2 = this.t2.PushFront(frameIdx), true
+	} else {
+		desc.elem, desc.inT2 = this.t1.PushFront(frameIdx), false
+	}
+	this.trimGhosts()
+
+	return page, nil
+}
+
+// findVictim picks an empty frame, or the LRU unpinned frame of t1 or t2
+// depending on target, falling back to the other list when every frame on
+// the preferred side is pinned. Caller must hold muLookup.
+func (this *ARCReplacer) findVictim(inB2 bool, target int) int {
+	if this.t1.Len()+this.t2.Len() < this.poolSize {
+		// Frames past poolSize are being retired by a shrink
+		for i, desc := range this.frames[:this.poolSize] {
+			// A claimed frame has no elem until its page is installed
+			if desc.elem == nil && atomic.LoadInt32(&desc.refCount) == 0 {
+				this.counters.scanSteps.Add(uint64(i + 1))
+				return i
+			}
+		}
+	}
+
+	first, second := this.evictionLists(inB2, target)
+	if frameIdx := this.lruUnpinned(first); frameIdx >= 0 {
+		return frameIdx
+	}
+	return this.lruUnpinned(second)
+}
+
+// evictionLists returns t1 and t2 in the order target says to evict from.
+func (this *ARCReplacer) evictionLists(inB2 bool, target int) (*list.List, *list.List) {
+	if this.t1.Len() > 0 && (this.t1.Len() > target || (inB2 && this.t1.Len() == target)) {
+		return this.t1, this.t2
+	}
+	return this.t2, this.t1
+}
+
+// WriteAhead looks at the frames from the LRU end of the list evicted from
+// first, then of the other one.
+func (this *ARCReplacer) WriteAhead(fm file.Filer, maxPages int) (int, error) {
+	return this.writeAhead(fm, maxPages, func() []int {
+		order := make([]int, 0, this.poolSize)
+		first, second := this.evictionLists(false, this.target)
+		for _, l := range []*list.List{first, second} {
+			for e := l.Back(); e != nil; e = e.Prev() {
+				order = append(order, e.Value.(int))
+			}
+		}
+		return order
+	})
+}
+
+func (this *ARCReplacer) lruUnpinned(l *list.List) int {
+	for e := l.Back(); e != nil; e = e.Prev() {
+		frameIdx := e.Value.(int)
+		this.counters.scanSteps.Add(1)
+		if frameIdx < this.poolSize && atomic.LoadInt32(&this.frames[frameIdx].refCount) == 0 {
+			return frameIdx
+		}
+	}
+	return -1
+}
+
+// adapt returns the t1 target moved after a ghost hit in b1 (grow) or b2
+// (shrink). The caller stores it once the hit is placed.
+func (this *ARCReplacer) adapt(inB2 bool) int {
+	if !inB2 {
+		delta := max(this.b2.Len()/max(this.b1.Len(), 1), 1)
+		return min(this.target+delta, this.poolSize)
+	}
+
+	delta := max(this.b1.Len()/max(this.b2.Len(), 1), 1)
+	return max(this.target-delta, 0)
+}
+
+// remember moves an evicted frame out of t1/t2 and records its page in the
+// matching ghost list.
+func (this *ARCReplacer) remember(desc *ARCDesc, pageId util.PageID) {
+	ghosts := this.b1
+	if desc.inT2 {
+		this.t2.Remove(desc.elem)
+		ghosts = this.b2
+	} else {
+		this.t1.Remove(desc.elem)
+	}
+	desc.elem, desc.inT2 = nil, false
+
+	if old, exist := this.ghosts[pageId]; exist {
+		this.forget(old)
+	}
+	this.ghosts[pageId] = ghosts.PushFront(arcGhost{pageId: pageId, inB2: ghosts == this.b2})
+}
+
+func (this *ARCReplacer) forget(elem *list.Element) {
+	ghost := elem.Value.(arcGhost)
+	if ghost.inB2 {
+		this.b2.Remove(elem)
+	} else {
+		this.b1.Remove(elem)
+	}
+	delete(this.ghosts, ghost.pageId)
+}
+
+// trimGhosts keeps |t1|+|b1| <= c and the whole directory within 2c.
+func (this *ARCReplacer) trimGhosts() {
+	for this.t1.Len()+this.b1.Len() > this.poolSize && this.b1.Len() > 0 {
+		this.forget(this.b1.Back())
+	}
+	for this.t1.Len()+this.t2.Len()+this.b1.Len()+this.b2.Len() > 2*this.poolSize && this.b2.Len() > 0 {
+		this.forget(this.b2.Back())
+	}
+}
+
+// RequestFrame reuses a ring frame while it is still in t1. The evicted page is
+// not remembered as a ghost, a scan must not move the target.
+func (this *ARCReplacer) RequestFrame(frameIdx int, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	return this.recycleFrame(frameIdx, pageId, src, fm, this.pin,
+		func(frameIdx int) bool {
+			return !this.frames[frameIdx].inT2
+		},
+		func(frameIdx int) {
+			desc := this.frames[frameIdx]
+			if desc.elem != nil {
+				this.t1.Remove(desc.elem)
+			}
+			desc.elem, desc.inT2 = this.t1.PushFront(frameIdx), false
+		})
+}
+
+// Resize keeps the ghost lists. A retired frame leaves t1 or t2 without a ghost,
+// and the target is clamped to the new size.
+func (this *ARCReplacer) Resize(ctx context.Context, newSize int, fm file.Filer) error {
+	return this.resize(ctx, newSize, fm,
+		func(n int) []*FrameDesc {
+			descs := make([]*FrameDesc, n)
+			for i := range descs {
+				desc := &ARCDesc{}
+				this.frames = append(this.frames, desc)
+				descs[i] = &desc.FrameDesc
+			}
+			return descs
+		},
+		func(frameIdx int) {
+			desc := this.frames[frameIdx]
+			if desc.elem != nil {
+				if desc.inT2 {
+					this.t2.Remove(desc.elem)
+				} else {
+					this.t1.Remove(desc.elem)
+				}
+			}
+			// Clipped, so a grow never writes into the array a sweep may still read
+			this.frames = slices.Clip(this.frames[:frameIdx])
+			this.target = min(this.target, this.poolSize)
+			this.trimGhosts()
+		})
+}
+
+func (this *ARCReplacer) Frames() iter.Seq[FrameInfo] {
+	return this.frameInfos(func(frameIdx int) int32 {
+		if this.frames[frameIdx].inT2 {
+			return 2
+		}
+		return 1
+	})
+}
+
+// pin must be called with muLookup held. A hit promotes the frame to t2,
+// except the first fetch of a prefetched page, which was seen once.
+func (this *ARCReplacer) pin(frameIdx int) error {
+	if err := this.pinFrame(frameIdx); err != nil {
+		return err
+	}
+
+	desc := this.frames[frameIdx]
+	if desc.inT2 {
+		this.t2.MoveToFront(desc.elem)
+		return nil
+	}
+	if this.firstTouch(frameIdx) {
+		this.t1.MoveToFront(desc.elem)
+		return nil
+	}
+	this.t1.Remove(desc.elem)
+	desc.elem, desc.inT2 = this.t2.PushFront(frameIdx), true
+
+	return nil
+}
+
+func (this *ARCReplacer) GetPage(pageId util.PageID) (*page.Page, error) {
+	return this.getPage(pageId, this.pin)
+}
+
+func (this *ARCReplacer) PinHandle(h FrameHandle) (*page.Page, error) {
+	return this.pinHandle(h, this.pin)
+}
+
+func (this *ARCReplacer) DeletePage(pageId util.PageID) error {
+	return this.deletePage(pageId, func(frameIdx int) {
+		desc := this.frames[frameIdx]
+		if desc.inT2 {
+			this.t2.Remove(desc.elem)
+		} else {
+			this.t1.Remove(desc.elem)
+		}
+		desc.elem, desc.inT2 = nil, false
+	})
+}
+
+func (this *ARCReplacer) ResetBuffer() {
+	this.pageToIdx = make(map[util.PageID]int)
+	this.Init(this.poolSize, this.ReplacerShared)
+}
@@ -0,0 +1,155 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvictionARC(t *testing.T) {
+	path, cleanup := util.CreateTempFile(t)
+	defer cleanup()
+	fm, err := file.NewFileManager(path, 8)
+	assert.NoError(t, err, "create FileManager")
+	defer fm.Close()
+
+	size := 3
+	shared := NewReplacerShared(size)
+	replacer := &ARCReplacer{}
+	replacer.Init(size, shared)
+
+	bp := NewBufferPool(fm, replacer, shared)
+
+	for i := util.PageID(0); i < 8; i++ {
+		assert.NoError(t, fm.WritePage(&page.Page{Header: page.PageHeader{PageID: i}}), "write test page %d", i)
+	}
+
+	access := func(pageId util.PageID) {
+		_, err := bp.FetchPage(pageId)
+		assert.NoError(t, err, "fetch page %d", pageId)
+		assert.NoError(t, bp.Release(pageId, false), "release page %d", pageId)
+	}
+
+	t.Run("HitPromotesToT2", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		access(0)
+		desc := replacer.frames[shared.pageToIdx[0]]
+		assert.False(t, desc.inT2, "first access lands in t1")
+		assert.Equal(t, 1, replacer.t1.Len(), "t1 size")
+
+		access(0)
+		assert.True(t, desc.inT2, "second access promotes to t2")
+		assert.Equal(t, 0, replacer.t1.Len(), "t1 size")
+		assert.Equal(t, 1, replacer.t2.Len(), "t2 size")
+	})
+
+	t.Run("EvictionRemembersGhost", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		// 0 is reused, 1 and 2 are seen once
+		access(0)
+		access(0)
+		access(1)
+		access(2)
+
+		// t1 is above its target of 0, so its LRU page goes to b1
+		access(3)
+		assert.NotContains(t, shared.pageToIdx, util.PageID(1), "LRU page of t1 is evicted")
+		assert.Contains(t, shared.pageToIdx, util.PageID(0), "t2 page stays")
+		assert.Contains(t, replacer.ghosts, util.PageID(1), "evicted page becomes a ghost")
+		assert.Equal(t, 1, replacer.b1.Len(), "b1 size")
+	})
+
+	t.Run("GhostHitAdaptsTarget", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		access(0)
+		access(0)
+		access(1)
+		access(2)
+		access(3) // evicts 1 into b1
+		assert.Equal(t, 0, replacer.target, "target before ghost hit")
+
+		access(1)
+		assert.Equal(t, 1, replacer.target, "b1 hit grows the t1 target")
+		assert.NotContains(t, replacer.ghosts, util.PageID(1), "ghost is consumed")
+		desc := replacer.frames[shared.pageToIdx[1]]
+		assert.True(t, desc.inT2, "ghost hit goes straight to t2")
+	})
+
+	t.Run("GhostHitAdaptsOncePlaced", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		access(0)
+		access(0)
+		access(1)
+		access(2)
+		access(3) // evicts 1 into b1
+		for _, pageId := range []util.PageID{0, 2, 3} {
+			_, err := bp.FetchPage(pageId)
+			assert.NoError(t, err, "pin page %d", pageId)
+		}
+
+		// Every sweep of the failed request sees the ghost, none may adapt
+		_, err := bp.FetchPage(1)
+		assert.ErrorIs(t, err, util.ErrNoFreeFrame, "every frame is pinned")
+		assert.Equal(t, 0, replacer.target, "target unchanged without a victim")
+		assert.Contains(t, replacer.ghosts, util.PageID(1), "ghost kept for the retry")
+
+		assert.NoError(t, bp.Release(2, false), "release page 2")
+		access(1)
+		assert.Equal(t, 1, replacer.target, "target grows once the hit is placed")
+		for _, pageId := range []util.PageID{0, 3} {
+			assert.NoError(t, bp.Release(pageId, false), "release page %d", pageId)
+		}
+	})
+
+	t.Run("GhostListsAreBounded", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		for i := util.PageID(0); i < 8; i++ {
+			access(i)
+		}
+		assert.LessOrEqual(t, replacer.t1.Len()+replacer.b1.Len(), size, "|t1|+|b1| <= c")
+		assert.LessOrEqual(t, replacer.t1.Len()+replacer.t2.Len()+replacer.b1.Len()+replacer.b2.Len(), 2*size, "directory <= 2c")
+		assert.Equal(t, len(replacer.ghosts), replacer.b1.Len()+replacer.b2.Len(), "ghost index matches ghost lists")
+	})
+
+	t.Run("PinnedFramesAreSkipped", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		for i := util.PageID(0); i < 3; i++ {
+			_, err := bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := bp.FetchPageContext(ctx, 3)
+		assert.ErrorIs(t, err, util.ErrNoFreeFrame, "every frame is pinned")
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "gave up at the deadline")
+
+		assert.NoError(t, bp.Release(2, false), "release page 2")
+		_, err = bp.FetchPage(3)
+		assert.NoError(t, err, "fetch page 3 after a release")
+		assert.NotContains(t, shared.pageToIdx, util.PageID(2), "only the unpinned page can go")
+
+		for _, pageId := range []util.PageID{0, 1, 3} {
+			assert.NoError(t, bp.Release(pageId, false), "release page %d", pageId)
+		}
+	})
+
+	t.Run("DeletePage_LeavesNoGhost", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		access(5)
+		assert.NoError(t, replacer.DeletePage(5), "delete page 5")
+		assert.Equal(t, 0, replacer.t1.Len()+replacer.t2.Len(), "deleted frame leaves t1/t2")
+		assert.NotContains(t, replacer.ghosts, util.PageID(5), "deleted page is not a ghost")
+	})
+}
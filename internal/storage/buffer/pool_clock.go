@@ -1,9 +1,9 @@
 package buffer
 
 import (
-	"fmt"
-	"math"
-	"sync"
+	"context"
+	"iter"
+	"slices"
 	"sync/atomic"
 
 	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
@@ -12,21 +12,15 @@ import (
 )
 
 type ClockDesc struct {
-	page       atomic.Pointer[page.Page]
+	FrameDesc
 	usageCount int32
-	refCount   int32
-	dirty      atomic.Bool
-
-	muPin sync.Mutex
 }
 
 type ClockReplacer struct {
-	frames []*ClockDesc // Holds page.Page (4KB)
+	frames []*ClockDesc // Each owns its page.Page (4KB), reused in place
 	*ReplacerShared
 	nextVictimIdx int32
 	maxLoop       int
-
-	muLookup sync.Mutex
 }
 
 func (this *ClockReplacer) Init(size int, maxLoop int, replacerShared *ReplacerShared) {
@@ -36,25 +30,45 @@ func (this *ClockReplacer) Init(size int, maxLoop int, replacerShared *ReplacerS
 	this.maxLoop = maxLoop
 
 	for i := 0; i < size; i++ {
-		this.frames[i] = &ClockDesc{
-			usageCount: 0,
-			refCount:   0,
-			dirty:      atomic.Bool{},
-		}
+		this.frames[i] = &ClockDesc{usageCount: 0}
+		this.descs[i] = &this.frames[i].FrameDesc
 	}
 }
 
-func (this *ClockReplacer) RequestFree(page *page.Page, fm *file.FileManager) error {
-	poolSize := int32(this.poolSize)
-	for {
+func (this *ClockReplacer) RequestFree(ctx context.Context, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	return this.sweepUntilFree(ctx, func() (*page.Page, error) {
+		return this.sweep(pageId, src, fm)
+	})
+}
+
+// sweep turns the clock hand until it places pageId, or fails with
+// ErrNoFreeFrame after a full turn that found every frame pinned.
+func (this *ClockReplacer) sweep(pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	// A resize replaces the slice, keep the frames this sweep started with
+	this.muLookup.Lock()
+	frames, poolSize := this.frames, int32(this.poolSize)
+	this.muLookup.Unlock()
+
+	sawUnpinned := false
+	for step := int32(1); ; step++ {
+		if step > poolSize {
+			if !sawUnpinned {
+				return nil, util.ErrNoFreeFrame
+			}
+			// Unpinned frames only had their usage count lowered, turn again
+			step, sawUnpinned = 1, false
+		}
+
 		// Atomically advance clock hand and get current position
 		victimIdx := atomic.AddInt32(&this.nextVictimIdx, 1) % poolSize
+		this.counters.scanSteps.Add(1)
 
-		desc := this.frames[victimIdx]
+		desc := frames[victimIdx]
 
 		if refCount := atomic.LoadInt32(&desc.refCount); refCount != 0 {
 			continue
 		}
+		sawUnpinned = true
 
 		if usageCount := atomic.LoadInt32(&desc.usageCount); usageCount > 0 {
 			atomic.AddInt32(&desc.usageCount, -1)
@@ -62,133 +76,110 @@ func (this *ClockReplacer) RequestFree(page *page.Page, fm *file.FileManager) er
 		}
 
 		this.muLookup.Lock()
-		defer this.muLookup.Unlock()
-		if frameIdx, exist := this.pageToIdx[page.Header.PageID]; exist {
-			if err := this.Pin(frameIdx); err != nil {
-				return err
-			}
-			return nil
+		// Another caller loaded the same page first, share its frame
+		if p, found, err := this.shareLoaded(pageId, this.pin); found {
+			this.muLookup.Unlock()
+			return p, err
 		}
 
 		frameIdx := int(victimIdx)
-		// to avoid race condition, store refcount math.MinInt32 as sentinel
-		if atomic.CompareAndSwapInt32(&desc.refCount, 0, math.MinInt32) {
-			dirty := desc.dirty.Load()
-			if dirty {
-				page := desc.page.Load()
-				if err := fm.WritePage(page); err != nil {
-					atomic.StoreInt32(&desc.refCount, 0)
-					return err
-				}
-			}
-
-			// Only delete from pageToIdx if there's actually a page in this frame
-			existingPage := desc.page.Load()
-			if existingPage != nil {
-				delete(this.pageToIdx, existingPage.Header.PageID)
-			}
-			this.pageToIdx[page.Header.PageID] = frameIdx
-			desc.page.Store(page)
-			desc.dirty.Store(false)
-			atomic.StoreInt32(&desc.usageCount, 1)
-			atomic.StoreInt32(&desc.refCount, 1)
-
-			desc.muPin.Lock()
-			desc.page.Load().Header.SetPinnedFlag()
-			desc.muPin.Unlock()
-
-			return nil
+		// Retired by a shrink, or pinned by GetPage after the check above,
+		// move on to the next frame
+		if !this.claimVictim(frameIdx) {
+			this.muLookup.Unlock()
+			continue
 		}
-	}
-}
 
-func (this *ClockReplacer) Pin(frameIdx int) error {
-	node := this.frames[frameIdx]
-	if nev := atomic.AddInt32(&node.refCount, 1) < 0; nev {
-		return util.ErrPageEvicted
+		atomic.StoreInt32(&desc.usageCount, 1)
+		page, err := this.installPage(frameIdx, pageId, src, fm)
+		this.muLookup.Unlock()
+		return page, err
 	}
+}
 
-	page := node.page.Load()
-	if page == nil {
-		return fmt.Errorf("frame %d is not allocated", frameIdx)
-	}
+// RequestFrame reuses a ring frame unless it was used again since it was loaded,
+// which is the usage count cap PostgreSQL applies to strategy buffers.
+func (this *ClockReplacer) RequestFrame(frameIdx int, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	return this.recycleFrame(frameIdx, pageId, src, fm, this.pin,
+		func(frameIdx int) bool {
+			return atomic.LoadInt32(&this.frames[frameIdx].usageCount) <= 1
+		},
+		func(frameIdx int) {
+			atomic.StoreInt32(&this.frames[frameIdx].usageCount, 1)
+		})
+}
 
-	node.muPin.Lock()
-	if !node.page.Load().Header.IsPinned() {
-		node.page.Load().Header.SetPinnedFlag()
-	}
-	node.muPin.Unlock()
-	// Successfully updated, now handle page header
+// WriteAhead looks at the frames in the order the hand reaches them, skipping
+// frames whose usage count keeps them for more than one more turn.
+func (this *ClockReplacer) WriteAhead(fm file.Filer, maxPages int) (int, error) {
+	return this.writeAhead(fm, maxPages, func() []int {
+		poolSize := int32(this.poolSize)
+		start := atomic.LoadInt32(&this.nextVictimIdx) + 1
+		order := make([]int, 0, this.poolSize)
+		for i := int32(0); i < poolSize; i++ {
+			frameIdx := (start + i) % poolSize
+			if atomic.LoadInt32(&this.frames[frameIdx].usageCount) <= 1 {
+				order = append(order, int(frameIdx))
+			}
+		}
+		return order
+	})
+}
 
-	if current := atomic.LoadInt32(&node.usageCount); current < int32(this.maxLoop) {
-		atomic.AddInt32(&node.usageCount, 1)
-	}
+func (this *ClockReplacer) Resize(ctx context.Context, newSize int, fm file.Filer) error {
+	return this.resize(ctx, newSize, fm,
+		func(n int) []*FrameDesc {
+			descs := make([]*FrameDesc, n)
+			for i := range descs {
+				desc := &ClockDesc{usageCount: 0}
+				this.frames = append(this.frames, desc)
+				descs[i] = &desc.FrameDesc
+			}
+			return descs
+		},
+		func(frameIdx int) {
+			// Clipped, so a grow never writes into the array a sweep may still read
+			this.frames = slices.Clip(this.frames[:frameIdx])
+		})
+}
 
-	return nil
+func (this *ClockReplacer) Frames() iter.Seq[FrameInfo] {
+	return this.frameInfos(func(frameIdx int) int32 {
+		return atomic.LoadInt32(&this.frames[frameIdx].usageCount)
+	})
 }
 
-func (this *ClockReplacer) Unpin(pageId util.PageID, isDirty bool) error {
-	this.muLookup.Lock()
-	frameIdx, exist := this.pageToIdx[pageId]
-	if !exist {
-		this.muLookup.Unlock()
-		return util.ErrPageNotFound
+// pin must be called with muLookup held.
+func (this *ClockReplacer) pin(frameIdx int) error {
+	if err := this.pinFrame(frameIdx); err != nil {
+		return err
 	}
-	this.muLookup.Unlock()
 
 	node := this.frames[frameIdx]
-	page := node.page.Load()
-	if page == nil {
-		return fmt.Errorf("frame %d is not allocated", frameIdx)
-	}
-
-	// Handle dirty flag first (while still pinned)
-	if isDirty {
-		node.dirty.Store(true)
-		node.muPin.Lock()
-		page.Header.SetDirtyFlag()
-		node.muPin.Unlock()
+	if this.firstTouch(frameIdx) {
+		// The prefetch is not a use, the scan's fetch is the first one
+		atomic.StoreInt32(&node.usageCount, 1)
+		return nil
 	}
-
-	if current := atomic.LoadInt32(&node.refCount); current <= 0 {
-		return fmt.Errorf("frame %d was not pinned", frameIdx)
-	}
-
-	if newCount := atomic.AddInt32(&node.refCount, -1); newCount == 0 {
-		node.muPin.Lock()
-		page.Header.ClearPinnedFlag()
-		node.muPin.Unlock()
+	if current := atomic.LoadInt32(&node.usageCount); current < int32(this.maxLoop) {
+		atomic.AddInt32(&node.usageCount, 1)
 	}
 
 	return nil
 }
 
-func (this *ClockReplacer) GetPinCount(frameIdx int) (int32, error) {
-	if frameIdx >= this.poolSize || frameIdx < 0 {
-		return 0, fmt.Errorf("invalid frame index %d", frameIdx)
-	}
-
-	return atomic.LoadInt32(&this.frames[frameIdx].refCount), nil
-}
-
 func (this *ClockReplacer) GetPage(pageId util.PageID) (*page.Page, error) {
-	this.muLookup.Lock()
-	defer this.muLookup.Unlock()
-	frameIdx, exist := this.pageToIdx[pageId]
-	if !exist {
-		return nil, util.ErrPageNotFound
-	}
+	return this.getPage(pageId, this.pin)
+}
 
-	if err := this.Pin(frameIdx); err != nil {
-		return nil, err
-	}
-	node := this.frames[frameIdx]
-	page := node.page.Load()
-	if page == nil {
-		return nil, fmt.Errorf("page id %d not found", pageId)
-	}
+func (this *ClockReplacer) PinHandle(h FrameHandle) (*page.Page, error) {
+	return this.pinHandle(h, this.pin)
+}
 
-	return node.page.Load(), nil
+func (this *ClockReplacer) DeletePage(pageId util.PageID) error {
+	return this.deletePage(pageId, func(frameIdx int) {
+		atomic.StoreInt32(&this.frames[frameIdx].usageCount, 0)
+	})
 }
 
 func (this *ClockReplacer) ResetBuffer() {
@@ -200,10 +191,7 @@ func (this *ClockReplacer) ResetBuffer() {
 
 	// Reset all frames to initial state
 	for i := 0; i < this.poolSize; i++ {
-		this.frames[i] = &ClockDesc{
-			usageCount: 0,
-			refCount:   0,
-			dirty:      atomic.Bool{},
-		}
+		this.frames[i] = &ClockDesc{usageCount: 0}
+		this.descs[i] = &this.frames[i].FrameDesc
 	}
 }
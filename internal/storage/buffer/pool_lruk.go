@@ -0,0 +1,221 @@
+package buffer
+
+import (
+	"context"
+	"iter"
+	"slices"
+	"sort"
+	"sync/atomic"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* LRU-K evicts the frame whose k-th most recent access is the oldest, i.e. the
+* largest backward k-distance. A frame seen fewer than k times has an infinite
+* distance, so pages touched once by a scan go before pages that are reused.
+* Ties between infinite frames fall back to plain LRU on the oldest access.
+**/
+type LRUKDesc struct {
+	FrameDesc
+	history []uint64 // timestamps of the last k accesses, oldest first
+}
+
+type LRUKReplacer struct {
+	frames []*LRUKDesc
+	*ReplacerShared
+	k           int
+	currentTime uint64 // logical clock, advanced on every access under muLookup
+}
+
+func (this *LRUKReplacer) Init(size int, k int, replacerShared *ReplacerShared) {
+	if k <= 0 {
+		panic(util.ErrInvalidLRUK)
+	}
+	this.frames = make([]*LRUKDesc, size)
+	this.ReplacerShared = replacerShared
+	this.k = k
+	this.currentTime = 0
+
+	for i := 0; i < size; i++ {
+		this.frames[i] = &LRUKDesc{history: make([]uint64, 0, k)}
+		this.descs[i] = &this.frames[i].FrameDesc
+	}
+}
+
+func (this *LRUKReplacer) RequestFree(ctx context.Context, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	return this.sweepUntilFree(ctx, func() (*page.Page, error) {
+		return this.sweep(pageId, src, fm)
+	})
+}
+
+// sweep places pageId in a victim frame, or fails with ErrNoFreeFrame if every
+// frame is pinned.
+func (this *LRUKReplacer) sweep(pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	this.muLookup.Lock()
+	defer this.muLookup.Unlock()
+
+	// Another caller loaded the same page first, share its frame
+	if p, found, err := this.shareLoaded(pageId, this.pin); found {
+		return p, err
+	}
+
+	frameIdx := this.findVictim()
+	if frameIdx < 0 {
+		return nil, util.ErrNoFreeFrame
+	}
+
+	// Pins only grow under muLookup, so an unpinned victim stays unpinned
+	if !this.claimVictim(frameIdx) {
+		return nil, util.ErrInvalidEviction
+	}
+	desc := this.frames[frameIdx]
+
+	page, err := this.installPage(frameIdx, pageId, src, fm)
+	if err != nil {
+		return nil, err
+	}
+	desc.history = desc.history[:0]
+	this.recordAccess(desc)
+
+	return page, nil
+}
+
+// findVictim returns the unpinned frame with the largest backward k-distance,
+// or -1 if every frame is pinned. Caller must hold muLookup.
+func (this *LRUKReplacer) findVictim() int {
+	victimIdx := -1
+	// Frames past poolSize are being retired by a shrink
+	for i, desc := range this.frames[:this.poolSize] {
+		if atomic.LoadInt32(&desc.refCount) != 0 {
+			continue
+		}
+		if desc.page.Load() == nil || len(desc.history) == 0 {
+			this.counters.scanSteps.Add(uint64(i + 1))
+			return i // empty frame
+		}
+
+		if victimIdx < 0 || this.evictsBefore(desc, this.frames[victimIdx]) {
+			victimIdx = i
+		}
+	}
+	this.counters.scanSteps.Add(uint64(this.poolSize))
+
+	return victimIdx
+}
+
+// evictsBefore orders frames by backward k-distance, largest first. history[0]
+// is the k-th most recent access once the frame has k of them.
+func (this *LRUKReplacer) evictsBefore(a, b *LRUKDesc) bool {
+	infA, infB := len(a.history) < this.k, len(b.history) < this.k
+	if infA != infB {
+		return infA
+	}
+	return a.history[0] < b.history[0]
+}
+
+// WriteAhead looks at the frames in eviction order.
+func (this *LRUKReplacer) WriteAhead(fm file.Filer, maxPages int) (int, error) {
+	return this.writeAhead(fm, maxPages, func() []int {
+		order := make([]int, 0, this.poolSize)
+		for i, desc := range this.frames {
+			if desc.page.Load() != nil && len(desc.history) > 0 {
+				order = append(order, i)
+			}
+		}
+		sort.Slice(order, func(a, b int) bool {
+			return this.evictsBefore(this.frames[order[a]], this.frames[order[b]])
+		})
+		return order
+	})
+}
+
+// recordAccess appends the current time to the frame history, keeping the
+// last k entries. Caller must hold muLookup.
+func (this *LRUKReplacer) recordAccess(desc *LRUKDesc) {
+	this.currentTime++
+	if len(desc.history) < this.k {
+		desc.history = append(desc.history, this.currentTime)
+		return
+	}
+
+	copy(desc.history, desc.history[1:])
+	desc.history[this.k-1] = this.currentTime
+}
+
+// RequestFrame reuses a ring frame while it has fewer than k accesses.
+func (this *LRUKReplacer) RequestFrame(frameIdx int, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	return this.recycleFrame(frameIdx, pageId, src, fm, this.pin,
+		func(frameIdx int) bool {
+			return len(this.frames[frameIdx].history) < this.k
+		},
+		func(frameIdx int) {
+			desc := this.frames[frameIdx]
+			desc.history = desc.history[:0]
+			this.recordAccess(desc)
+		})
+}
+
+func (this *LRUKReplacer) Resize(ctx context.Context, newSize int, fm file.Filer) error {
+	return this.resize(ctx, newSize, fm,
+		func(n int) []*FrameDesc {
+			descs := make([]*FrameDesc, n)
+			for i := range descs {
+				desc := &LRUKDesc{history: make([]uint64, 0, this.k)}
+				this.frames = append(this.frames, desc)
+				descs[i] = &desc.FrameDesc
+			}
+			return descs
+		},
+		func(frameIdx int) {
+			// Clipped, so a grow never writes into the array a sweep may still read
+			this.frames = slices.Clip(this.frames[:frameIdx])
+		})
+}
+
+func (this *LRUKReplacer) Frames() iter.Seq[FrameInfo] {
+	return this.frameInfos(func(frameIdx int) int32 {
+		return int32(len(this.frames[frameIdx].history))
+	})
+}
+
+// pin must be called with muLookup held.
+func (this *LRUKReplacer) pin(frameIdx int) error {
+	if err := this.pinFrame(frameIdx); err != nil {
+		return err
+	}
+
+	desc := this.frames[frameIdx]
+	if this.firstTouch(frameIdx) {
+		// The prefetch is not an access, the scan's fetch is the first one
+		desc.history = desc.history[:0]
+	}
+	this.recordAccess(desc)
+	return nil
+}
+
+func (this *LRUKReplacer) GetPage(pageId util.PageID) (*page.Page, error) {
+	return this.getPage(pageId, this.pin)
+}
+
+func (this *LRUKReplacer) PinHandle(h FrameHandle) (*page.Page, error) {
+	return this.pinHandle(h, this.pin)
+}
+
+func (this *LRUKReplacer) DeletePage(pageId util.PageID) error {
+	return this.deletePage(pageId, func(frameIdx int) {
+		this.frames[frameIdx].history = this.frames[frameIdx].history[:0]
+	})
+}
+
+func (this *LRUKReplacer) ResetBuffer() {
+	this.pageToIdx = make(map[util.PageID]int)
+	this.currentTime = 0
+
+	for i := 0; i < this.poolSize; i++ {
+		this.frames[i] = &LRUKDesc{history: make([]uint64, 0, this.k)}
+		this.descs[i] = &this.frames[i].FrameDesc
+	}
+}
@@ -0,0 +1,219 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBufferPoolLRUK(t *testing.T) {
+	t.Run("ValidSize", func(t *testing.T) {
+		size := 10
+		k := 2
+		shared := NewReplacerShared(size)
+		replacer := &LRUKReplacer{}
+		replacer.Init(size, k, shared)
+
+		assert.Equal(t, size, len(replacer.frames), "frames should be matched size")
+		assert.Equal(t, k, replacer.k, "k should be matched")
+		for i := 0; i < size; i++ {
+			assert.Same(t, &replacer.frames[i].FrameDesc, shared.descs[i], "shared desc %d", i)
+			assert.Empty(t, replacer.frames[i].history, "history initialed empty at %d", i)
+		}
+	})
+
+	t.Run("ZeroK", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected panic for k=0")
+			}
+		}()
+		replacer := &LRUKReplacer{}
+		replacer.Init(1, 0, NewReplacerShared(1))
+	})
+}
+
+func TestEvictionLRUK(t *testing.T) {
+	path, cleanup := util.CreateTempFile(t)
+	defer cleanup()
+	fm, err := file.NewFileManager(path, 6)
+	assert.NoError(t, err, "create FileManager")
+	defer fm.Close()
+
+	size := 3
+	k := 2
+	shared := NewReplacerShared(size)
+	replacer := &LRUKReplacer{}
+	replacer.Init(size, k, shared)
+
+	bp := NewBufferPool(fm, replacer, shared)
+
+	for i := util.PageID(0); i < 6; i++ {
+		assert.NoError(t, fm.WritePage(&page.Page{Header: page.PageHeader{PageID: i}}), "write test page %d", i)
+	}
+
+	access := func(pageId util.PageID) {
+		_, err := bp.FetchPage(pageId)
+		assert.NoError(t, err, "fetch page %d", pageId)
+		assert.NoError(t, bp.Release(pageId, false), "release page %d", pageId)
+	}
+
+	t.Run("FewerThanK_EvictedFirst", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		// 0 and 1 reach k accesses, 2 is only seen once
+		access(0)
+		access(1)
+		access(2)
+		access(0)
+		access(1)
+
+		access(3)
+		assert.NotContains(t, shared.pageToIdx, util.PageID(2), "page with fewer than k accesses goes first")
+		assert.Contains(t, shared.pageToIdx, util.PageID(0), "page 0 stays")
+		assert.Contains(t, shared.pageToIdx, util.PageID(1), "page 1 stays")
+	})
+
+	t.Run("LargestBackwardKDistance", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		// k-th most recent access: page 1 -> t1, page 0 -> t2, page 2 -> t5
+		access(1)
+		access(0)
+		access(1)
+		access(0)
+		access(2)
+		access(2)
+
+		access(3)
+		assert.NotContains(t, shared.pageToIdx, util.PageID(1), "page 1 has the oldest k-th access")
+		assert.Contains(t, shared.pageToIdx, util.PageID(0), "page 0 stays")
+		assert.Contains(t, shared.pageToIdx, util.PageID(2), "page 2 stays")
+	})
+
+	t.Run("InfiniteTieBreaksOnOldestAccess", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		access(0)
+		access(1)
+		access(2)
+
+		access(3)
+		assert.NotContains(t, shared.pageToIdx, util.PageID(0), "oldest single access goes first")
+	})
+
+	t.Run("PinnedFramesAreSkipped", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		for i := util.PageID(0); i < 3; i++ {
+			_, err := bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := bp.FetchPageContext(ctx, 3)
+		assert.ErrorIs(t, err, util.ErrNoFreeFrame, "every frame is pinned")
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "gave up at the deadline")
+
+		assert.NoError(t, bp.Release(1, false), "release page 1")
+		_, err = bp.FetchPage(3)
+		assert.NoError(t, err, "fetch page 3 after a release")
+		assert.NotContains(t, shared.pageToIdx, util.PageID(1), "only the unpinned page can go")
+
+		for _, pageId := range []util.PageID{0, 2, 3} {
+			assert.NoError(t, bp.Release(pageId, false), "release page %d", pageId)
+		}
+	})
+
+	t.Run("DeletePage_ResetsHistory", func(t *testing.T) {
+		replacer.ResetBuffer()
+
+		access(4)
+		access(4)
+		frameIdx := shared.pageToIdx[4]
+		assert.Len(t, replacer.frames[frameIdx].history, 2, "history holds k accesses")
+		assert.NoError(t, replacer.DeletePage(4), "delete page 4")
+		assert.Empty(t, replacer.frames[frameIdx].history, "history cleared on delete")
+	})
+}
+
+// Mixed workload: most accesses hit a small hot set, the rest is a sequential
+// scan over cold pages that is larger than the pool.
+func BenchmarkReplacerMixedWorkload(b *testing.B) {
+	const (
+		poolSize  = 32
+		hotPages  = 28
+		coldPages = 512
+	)
+
+	policies := []struct {
+		name string
+		new  func(shared *ReplacerShared) Replacer
+	}{
+		{"Clock", func(shared *ReplacerShared) Replacer {
+			replacer := &ClockReplacer{}
+			replacer.Init(poolSize, 3, shared)
+			return replacer
+		}},
+		{"LRU-2", func(shared *ReplacerShared) Replacer {
+			replacer := &LRUKReplacer{}
+			replacer.Init(poolSize, 2, shared)
+			return replacer
+		}},
+		{"ARC", func(shared *ReplacerShared) Replacer {
+			replacer := &ARCReplacer{}
+			replacer.Init(poolSize, shared)
+			return replacer
+		}},
+	}
+
+	for _, policy := range policies {
+		b.Run(policy.name, func(b *testing.B) {
+			path := fmt.Sprintf("%s/bench.dat", b.TempDir())
+			fm, err := file.NewFileManager(path, hotPages+coldPages)
+			if err != nil {
+				b.Fatalf("create FileManager: %v", err)
+			}
+			defer fm.Close()
+			for i := util.PageID(0); i < hotPages+coldPages; i++ {
+				if err := fm.WritePage(&page.Page{Header: page.PageHeader{PageID: i}}); err != nil {
+					b.Fatalf("write page %d: %v", i, err)
+				}
+			}
+
+			shared := NewReplacerShared(poolSize)
+			bp := NewBufferPool(fm, policy.new(shared), shared)
+			rng := rand.New(rand.NewSource(1))
+			scanPos := 0
+			hits := 0
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var pageId util.PageID
+				if rng.Intn(10) < 8 {
+					pageId = util.PageID(rng.Intn(hotPages))
+				} else {
+					pageId = util.PageID(hotPages + scanPos)
+					scanPos = (scanPos + 1) % coldPages
+				}
+
+				if _, err := bp.GetPage(pageId); err == nil {
+					hits++
+				} else if _, err := bp.AllocateFrame(pageId); err != nil {
+					b.Fatalf("allocate page %d: %v", pageId, err)
+				}
+				if err := bp.Release(pageId, false); err != nil {
+					b.Fatalf("release page %d: %v", pageId, err)
+				}
+			}
+			b.ReportMetric(float64(hits)/float64(b.N), "hit-ratio")
+		})
+	}
+}
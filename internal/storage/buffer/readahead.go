@@ -0,0 +1,166 @@
+package buffer
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+// READ_AHEAD_MIN_RUN is the number of consecutive page ids fetched before a
+// scan counts as sequential.
+const READ_AHEAD_MIN_RUN = 3
+
+// READ_AHEAD_INITIAL_PAGES is the first window read ahead of a sequential scan.
+const READ_AHEAD_INITIAL_PAGES = 4
+
+/**
+* readAhead detects a sequential scan from the page ids fetched, like the Linux
+* page cache read-ahead. Once READ_AHEAD_MIN_RUN consecutive ids were fetched it
+* asks for a window of the following pages, and asks for the next window when
+* the scan is halfway through the previous one, doubling it up to maxPages.
+* Any other id restarts the detection.
+**/
+type readAhead struct {
+	mu       sync.Mutex
+	maxPages int
+	last     util.PageID // last page fetched
+	run      int         // consecutive ids ending at last
+	window   int         // pages of the last window, 0 before the first one
+	until    util.PageID // pages below were already asked for
+}
+
+func newReadAhead(maxPages int) (*readAhead, error) {
+	if maxPages <= 0 {
+		return nil, util.ErrInvalidReadAhead
+	}
+
+	return &readAhead{maxPages: maxPages}, nil
+}
+
+// next records a fetch of pageId and returns the pages to read ahead, if any.
+func (ra *readAhead) next(pageId util.PageID) []util.PageID {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	switch {
+	case ra.run > 0 && pageId == ra.last:
+		return nil // Same page again, e.g. a second tuple
+	case ra.run > 0 && pageId == ra.last+1:
+		ra.run++
+	default:
+		ra.run, ra.window, ra.until = 1, 0, pageId+1
+	}
+	ra.last = pageId
+
+	if ra.run < READ_AHEAD_MIN_RUN {
+		return nil
+	}
+	if ra.window > 0 && pageId+util.PageID(ra.window/2) < ra.until {
+		return nil
+	}
+
+	ra.window = min(max(ra.window*2, READ_AHEAD_INITIAL_PAGES), ra.maxPages)
+	from := max(ra.until, pageId+1)
+	ra.until = pageId + 1 + util.PageID(ra.window)
+
+	ids := make([]util.PageID, 0, ra.until-from)
+	for id := from; id < ra.until; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// EnableReadAhead starts detecting sequential fetches. Once a scan is detected,
+// FetchPage prefetches up to opts.ReadAheadPages pages ahead of it. Fetches
+// through an access strategy only hint the pages to the OS, so read-ahead
+// never takes frames outside the strategy's ring.
+func (bp *BufferPool) EnableReadAhead(opts util.Options) error {
+	ra, err := newReadAhead(opts.ReadAheadPages)
+	if err != nil {
+		return err
+	}
+
+	bp.readAhead.Store(ra)
+	return nil
+}
+
+// DisableReadAhead stops the sequential detection. Prefetches already started
+// still run to completion.
+func (bp *BufferPool) DisableReadAhead() {
+	bp.readAhead.Store(nil)
+}
+
+// readAheadOf feeds the detector with a fetch of pageId.
+func (bp *BufferPool) readAheadOf(pageId util.PageID, strategy *AccessStrategy) {
+	ra := bp.readAhead.Load()
+	if ra == nil {
+		return
+	}
+
+	ids := ra.next(pageId)
+	if len(ids) == 0 {
+		return
+	}
+	if strategy != nil {
+		// Best effort, a failed hint only costs the reads it would have saved
+		_ = bp.fm.WillNeed(ids)
+		return
+	}
+	_ = bp.Prefetch(ids)
+}
+
+// Prefetch loads the pages into unpinned frames in the background and returns
+// at once. Pages already resident or being loaded are skipped. A page never
+// waits for a frame, it is dropped while every frame is pinned, and pages
+// past the end of the file are ignored. The whole batch is first hinted to the
+// OS with WillNeed. Close waits for the prefetches in flight.
+func (bp *BufferPool) Prefetch(ids []util.PageID) error {
+	bp.muLoading.Lock()
+	if bp.closed.Load() {
+		bp.muLoading.Unlock()
+		return util.ErrBufferPoolClosed
+	}
+	bp.prefetching.Add(1)
+	bp.muLoading.Unlock()
+
+	ids = slices.Clone(ids)
+	go func() {
+		defer bp.prefetching.Done()
+
+		_ = bp.fm.WillNeed(ids)
+
+		// A done context makes RequestFree give up instead of waiting for an unpin
+		noWait, cancel := context.WithCancel(context.Background())
+		cancel()
+		for _, pageId := range ids {
+			if bp.closed.Load() {
+				return
+			}
+			bp.prefetch(noWait, pageId)
+		}
+	}()
+
+	return nil
+}
+
+// prefetch loads one page like a FetchPage miss and unpins it right away. The
+// page is placed untouched, so the policy does not take the scan's fetch for
+// a reuse.
+func (bp *BufferPool) prefetch(ctx context.Context, pageId util.PageID) {
+	bp.muLoading.Lock()
+	if _, ok := bp.loading[pageId]; ok || bp.rs.isResident(pageId) {
+		bp.muLoading.Unlock()
+		return
+	}
+	load := &pageLoad{done: make(chan struct{})}
+	bp.loading[pageId] = load
+	bp.muLoading.Unlock()
+
+	if _, err := bp.loadPage(ctx, pageId, prefetched{bp.fm}, nil, load); err != nil {
+		return
+	}
+	bp.counters.prefetched.Add(1)
+	_ = bp.replacer.Unpin(pageId, false)
+}
@@ -0,0 +1,145 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAheadDetector(t *testing.T) {
+	_, err := newReadAhead(0)
+	assert.ErrorIs(t, err, util.ErrInvalidReadAhead, "page limit must be positive")
+
+	ra, _ := newReadAhead(8)
+	assert.Empty(t, ra.next(10), "first fetch")
+	assert.Empty(t, ra.next(11), "run of two")
+	assert.Equal(t, []util.PageID{13, 14, 15, 16}, ra.next(12), "initial window after three consecutive ids")
+	assert.Empty(t, ra.next(12), "same page again")
+	assert.Empty(t, ra.next(13), "inside the first half of the window")
+	assert.Empty(t, ra.next(14), "inside the first half of the window")
+	assert.Equal(t, []util.PageID{17, 18, 19, 20, 21, 22, 23}, ra.next(15), "window doubles and skips pages already asked for")
+	assert.Empty(t, ra.next(19), "jump restarts the detection")
+	assert.Empty(t, ra.next(20), "run of two")
+	assert.Equal(t, []util.PageID{22, 23, 24, 25}, ra.next(21), "window starts over")
+}
+
+func readAheadOptions(maxPages int) util.Options {
+	opts := util.DefaultOptions()
+	opts.ReadAheadPages = maxPages
+	return opts
+}
+
+func TestPrefetch(t *testing.T) {
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			t.Run("LoadsUnpinned", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 8, 16)
+				assert.NoError(t, sp.bp.Prefetch([]util.PageID{2, 3, 4, 100}), "prefetch")
+				sp.bp.prefetching.Wait()
+
+				for i := util.PageID(2); i <= 4; i++ {
+					frameIdx, exist := sp.resident(i)
+					assert.True(t, exist, "page %d prefetched", i)
+					pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+					assert.Equal(t, int32(0), pinCount, "prefetched page %d unpinned", i)
+				}
+				_, exist := sp.resident(100)
+				assert.False(t, exist, "page past the end of the file ignored")
+				assert.Equal(t, uint64(3), sp.bp.Stats().Prefetched, "prefetched pages counted")
+
+				p, err := sp.bp.FetchPage(3)
+				assert.NoError(t, err, "fetch prefetched page")
+				assert.Equal(t, util.PageID(3), p.Header.PageID, "correct page")
+				assert.Equal(t, uint64(1), sp.bp.Stats().Hits, "fetch after prefetch is a hit")
+				assert.NoError(t, sp.bp.Release(3, false))
+			})
+
+			t.Run("ScanFetchIsFirstAccess", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 8, 16)
+				assert.NoError(t, sp.bp.Prefetch([]util.PageID{3}), "prefetch")
+				sp.bp.prefetching.Wait()
+
+				_, err := sp.bp.FetchPage(3)
+				assert.NoError(t, err, "fetch prefetched page")
+				assert.NoError(t, sp.bp.Release(3, false))
+				frameIdx, _ := sp.resident(3)
+				for info := range sp.replacer.Frames() {
+					if info.FrameIdx == frameIdx {
+						assert.Equal(t, int32(1), info.Usage, "scan fetch counts as the first access")
+					}
+				}
+
+				_, err = sp.bp.FetchPage(3)
+				assert.NoError(t, err, "fetch page 3 again")
+				assert.NoError(t, sp.bp.Release(3, false))
+				for info := range sp.replacer.Frames() {
+					if info.FrameIdx == frameIdx {
+						assert.Equal(t, int32(2), info.Usage, "second fetch is a reuse")
+					}
+				}
+			})
+
+			t.Run("NeverWaitsForFrame", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 2, 4)
+				for i := util.PageID(0); i < 2; i++ {
+					_, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d", i)
+				}
+
+				assert.NoError(t, sp.bp.Prefetch([]util.PageID{2, 3}), "prefetch")
+				sp.bp.prefetching.Wait()
+				for i := util.PageID(2); i < 4; i++ {
+					_, exist := sp.resident(i)
+					assert.False(t, exist, "page %d dropped while every frame is pinned", i)
+				}
+				for i := util.PageID(0); i < 2; i++ {
+					assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+				}
+			})
+		})
+	}
+
+	t.Run("SequentialScan", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 16, 16)
+		assert.ErrorIs(t, sp.bp.EnableReadAhead(readAheadOptions(0)), util.ErrInvalidReadAhead, "no pages to read ahead")
+		assert.NoError(t, sp.bp.EnableReadAhead(readAheadOptions(8)), "enable read-ahead")
+		for i := util.PageID(0); i < 3; i++ {
+			_, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+			assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+		}
+		sp.bp.prefetching.Wait()
+
+		for i := util.PageID(3); i < 7; i++ {
+			_, exist := sp.resident(i)
+			assert.True(t, exist, "page %d read ahead", i)
+		}
+		_, exist := sp.resident(7)
+		assert.False(t, exist, "window stops after the initial pages")
+	})
+
+	t.Run("StrategyOnlyHints", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 16, 16)
+		assert.NoError(t, sp.bp.EnableReadAhead(readAheadOptions(8)), "enable read-ahead")
+		strategy := NewAccessStrategyWithSize(2)
+		for i := util.PageID(0); i < 3; i++ {
+			_, err := sp.bp.FetchPageWith(context.Background(), i, strategy)
+			assert.NoError(t, err, "scan page %d", i)
+			assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+		}
+		sp.bp.prefetching.Wait()
+
+		_, exist := sp.resident(3)
+		assert.False(t, exist, "read-ahead stays out of the pool for a ring scan")
+		assert.Equal(t, uint64(0), sp.bp.Stats().Prefetched, "nothing prefetched")
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 4, 4)
+		assert.NoError(t, sp.bp.Prefetch([]util.PageID{0, 1, 2, 3}), "prefetch")
+		assert.NoError(t, sp.bp.Close(), "close waits for the prefetch")
+		assert.ErrorIs(t, sp.bp.Prefetch([]util.PageID{0}), util.ErrBufferPoolClosed)
+	})
+}
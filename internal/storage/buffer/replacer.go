@@ -1,6 +1,10 @@
 package buffer
 
 import (
+	"context"
+	"iter"
+	"sync"
+
 	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
 	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
 	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
@@ -8,11 +12,97 @@ import (
 
 // Replacer defines the contract for page replacement policies.
 type Replacer interface {
-	// Request a frame for allocating and evict if needed. returns an evictable frame index, or error if none.
-	RequestFree(page *page.Page, fm *file.FileManager) error
-	Pin(frameIdx int) error
+	// Request a frame for pageId and evict if needed, then fill the frame's own page from src.
+	// Returns the pinned page now resident for pageId, which is the frame of another caller if it
+	// loaded the page first. While every frame is pinned it waits for an unpin, and fails with
+	// ErrNoFreeFrame once ctx is done, after the configured wait timeout if ctx has no deadline,
+	// or after the configured number of sweeps.
+	RequestFree(ctx context.Context, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error)
+	// Reuse a given frame for pageId, as an access strategy recycling its ring does. Fails with
+	// ErrNoFreeFrame if the frame is pinned or the policy no longer considers it cold.
+	RequestFrame(frameIdx int, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error)
+	// Pin the resident page of a frame and count the access. Caller must hold muLookup.
+	pin(frameIdx int) error
 	Unpin(page util.PageID, isDirty bool) error
+	MarkDirty(pageId util.PageID) error
 	GetPinCount(frameIdx int) (int32, error)
 	GetPage(pageId util.PageID) (*page.Page, error)
+	// Write a resident page back if dirty, or every dirty frame, and clear the dirty flag.
+	FlushPage(pageId util.PageID, fm file.Filer) error
+	FlushAll(fm file.Filer) error
+	// Write back up to maxPages dirty unpinned frames, the ones the policy would evict first,
+	// so eviction finds them clean. Returns the number of pages written.
+	WriteAhead(fm file.Filer, maxPages int) (int, error)
+	// Drop an unpinned page from its frame without writing it back.
+	DeletePage(pageId util.PageID) error
+	// Latch guarding the data of a page the caller has pinned.
+	Latch(pageId util.PageID) (*sync.RWMutex, error)
+	// Pin the page of a handle without looking it up, ErrStaleHandle once its frame was reused.
+	PinHandle(h FrameHandle) (*page.Page, error)
+	// Grow or shrink the pool to newSize frames. Shrinking retires the last frames, waiting
+	// for their pages to be unpinned and writing them back if dirty. On ctx expiry it fails
+	// with ErrPagePinned and keeps the frames not retired yet.
+	Resize(ctx context.Context, newSize int, fm file.Filer) error
+	// Counters of the policy, and the state of every frame.
+	Stats() ReplacerStats
+	Frames() iter.Seq[FrameInfo]
 	ResetBuffer() // for testing purpose
 }
+
+// PageSource fills the page of the frame a page is placed in. A file.Filer
+// reads the page from disk, newPages zeroes it for a page never written yet.
+// dst must be left untouched on error, the frame still holds its old page.
+type PageSource interface {
+	ReadPageInto(pageId util.PageID, dst *page.Page) error
+}
+
+// newPages is the PageSource of pages allocated by NewPage.
+type newPages struct{}
+
+func (newPages) ReadPageInto(pageId util.PageID, dst *page.Page) error {
+	*dst = page.Page{Header: page.PageHeader{PageID: pageId}}
+	return nil
+}
+
+// prefetched is the PageSource of pages read ahead of a scan. They are placed
+// untouched, the scan's first fetch counts as their first access.
+type prefetched struct {
+	PageSource
+}
+
+// NewReplacer builds the replacement policy selected in opts, sized to
+// opts.BufferPoolSize, together with its shared state.
+func NewReplacer(opts util.Options) (Replacer, *ReplacerShared, error) {
+	if opts.BufferPoolSize <= 0 {
+		return nil, nil, util.ErrInvalidPoolSize
+	}
+	if opts.FrameWaitSweeps <= 0 {
+		return nil, nil, util.ErrInvalidWaitSweeps
+	}
+	if opts.FrameWaitTimeout <= 0 {
+		return nil, nil, util.ErrInvalidWaitTimeout
+	}
+	shared := NewReplacerShared(opts.BufferPoolSize)
+	shared.maxSweeps = opts.FrameWaitSweeps
+	shared.waitTimeout = opts.FrameWaitTimeout
+
+	switch opts.Replacer {
+	case util.ReplacerClock:
+		replacer := &ClockReplacer{}
+		replacer.Init(opts.BufferPoolSize, opts.ClockMaxLoop, shared)
+		return replacer, shared, nil
+	case util.ReplacerLRUK:
+		if opts.LRUK <= 0 {
+			return nil, nil, util.ErrInvalidLRUK
+		}
+		replacer := &LRUKReplacer{}
+		replacer.Init(opts.BufferPoolSize, opts.LRUK, shared)
+		return replacer, shared, nil
+	case util.ReplacerARC:
+		replacer := &ARCReplacer{}
+		replacer.Init(opts.BufferPoolSize, shared)
+		return replacer, shared, nil
+	default:
+		return nil, nil, util.ErrUnknownReplacer
+	}
+}
@@ -1,6 +1,17 @@
 package buffer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
 	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
 )
 
@@ -8,6 +19,48 @@ import (
 type ReplacerShared struct {
 	pageToIdx map[util.PageID]int // Map PageID to frame index
 	poolSize  int                 // Total frames
+	descs     []*FrameDesc        // Policy independent part of each frame, set by the policy's Init
+
+	muLookup sync.Mutex // Guards pageToIdx and swapping the page held by a frame
+	// Pages moving in or out of a frame while installPage runs without muLookup,
+	// each with a channel closed once the install is done
+	installing map[util.PageID]chan struct{}
+
+	maxSweeps   int           // sweeps finding every frame pinned before RequestFree gives up
+	waitTimeout time.Duration // longest wait of a RequestFree whose ctx is never done
+	unpinned    chan struct{} // closed by the next unpin that frees a frame, nil without waiters
+	waiting     atomic.Bool
+	muUnpin     sync.Mutex
+
+	counters replacerCounters
+	muResize sync.Mutex // Serializes resizes
+}
+
+// DEFAULT_WAIT_SWEEPS and DEFAULT_WAIT_TIMEOUT are used by replacers not built
+// through NewReplacer.
+const (
+	DEFAULT_WAIT_SWEEPS  = 4
+	DEFAULT_WAIT_TIMEOUT = time.Second
+)
+
+// FrameDesc is the part of a frame that does not depend on the replacement
+// policy. Policies embed it in their own descriptor.
+type FrameDesc struct {
+	page     atomic.Pointer[page.Page] // &buf while the frame holds a page, nil if empty
+	buf      page.Page                 // owned by the frame, every page it holds is read into it
+	refCount int32
+	dirty    atomic.Bool
+
+	muPin sync.Mutex
+	latch sync.RWMutex // guards page data, held through page guards
+	// Seqlock style version for optimistic reads: odd while a WritePageGuard
+	// holds the latch, and moved by 2 when the frame gets another page.
+	version atomic.Uint64
+	// Bumped when the frame gets another page, so a FrameHandle can tell the
+	// frame was reused. Guarded by muLookup.
+	generation uint64
+	// Placed by a prefetch and not pinned since. Guarded by muLookup.
+	untouched bool
 }
 
 // NewReplacerShared initializes the shared replacer state.
@@ -16,12 +69,210 @@ func NewReplacerShared(size int) *ReplacerShared {
 		panic(util.ErrInvalidPoolSize)
 	}
 	rs := &ReplacerShared{
-		pageToIdx: make(map[util.PageID]int, size),
-		poolSize:  size,
+		pageToIdx:   make(map[util.PageID]int, size),
+		installing:  make(map[util.PageID]chan struct{}),
+		poolSize:    size,
+		descs:       make([]*FrameDesc, size),
+		maxSweeps:   DEFAULT_WAIT_SWEEPS,
+		waitTimeout: DEFAULT_WAIT_TIMEOUT,
 	}
 	return rs
 }
 
+// unpinWait returns a channel closed by the next unpin that frees a frame.
+// Take it before sweeping, so an unpin during the sweep is not missed.
+func (rs *ReplacerShared) unpinWait() <-chan struct{} {
+	rs.muUnpin.Lock()
+	defer rs.muUnpin.Unlock()
+	if rs.unpinned == nil {
+		rs.unpinned = make(chan struct{})
+		rs.waiting.Store(true)
+	}
+	return rs.unpinned
+}
+
+// notifyUnpin wakes every RequestFree waiting for a frame.
+func (rs *ReplacerShared) notifyUnpin() {
+	if !rs.waiting.Load() {
+		return
+	}
+
+	rs.muUnpin.Lock()
+	defer rs.muUnpin.Unlock()
+	if rs.unpinned != nil {
+		close(rs.unpinned)
+		rs.unpinned = nil
+		rs.waiting.Store(false)
+	}
+}
+
+// pageInstalling is returned by a sweep finding its page moving in or out of a
+// frame, see installPage. sweepUntilFree waits for done, then sweeps again.
+type pageInstalling struct {
+	done <-chan struct{}
+}
+
+func (e *pageInstalling) Error() string {
+	return "page is being installed in a frame"
+}
+
+// sweepUntilFree runs the policy's sweep until it places the page. A sweep
+// reports ErrNoFreeFrame when it found every frame pinned, then the caller
+// waits for an unpin or for ctx, and gives up after maxSweeps such sweeps. A
+// ctx that is never done waits at most waitTimeout, so a pool whose frames
+// stay pinned fails the request instead of blocking it forever.
+func (rs *ReplacerShared) sweepUntilFree(ctx context.Context, sweep func() (*page.Page, error)) (*page.Page, error) {
+	rs.counters.requests.Add(1)
+	var wait <-chan struct{}
+	for sweeps := 1; ; sweeps++ {
+		resident, err := sweep()
+		var installing *pageInstalling
+		if errors.As(err, &installing) {
+			// Another caller is loading the page, share its frame once loaded
+			sweeps--
+			select {
+			case <-installing.done:
+				continue
+			case <-ctx.Done():
+				rs.counters.noFreeFrame.Add(1)
+				return nil, fmt.Errorf("%w: %w", util.ErrNoFreeFrame, ctx.Err())
+			}
+		}
+		if !errors.Is(err, util.ErrNoFreeFrame) {
+			return resident, err
+		}
+		if sweeps >= rs.maxSweeps {
+			rs.counters.noFreeFrame.Add(1)
+			return nil, err
+		}
+
+		// Register before sweeping again, so an unpin in between is not missed
+		if wait == nil {
+			wait = rs.unpinWait()
+			continue
+		}
+		if ctx.Done() == nil {
+			// Only once, the timeout context can be done
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, rs.waitTimeout)
+			defer cancel()
+		}
+		rs.counters.waits.Add(1)
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			rs.counters.noFreeFrame.Add(1)
+			return nil, fmt.Errorf("%w: %w", util.ErrNoFreeFrame, ctx.Err())
+		}
+		wait = rs.unpinWait()
+	}
+}
+
+// resize grows or shrinks the pool to newSize frames. grow appends n frames to
+// the policy and returns their FrameDesc, retire drops the policy state of the
+// last frame. Both run under muLookup.
+func (rs *ReplacerShared) resize(ctx context.Context, newSize int, fm file.Filer,
+	grow func(n int) []*FrameDesc, retire func(frameIdx int)) error {
+	if newSize <= 0 {
+		return util.ErrInvalidPoolSize
+	}
+
+	rs.muResize.Lock()
+	defer rs.muResize.Unlock()
+
+	rs.muLookup.Lock()
+	oldSize := len(rs.descs)
+	if newSize >= oldSize {
+		rs.descs = append(rs.descs, grow(newSize-oldSize)...)
+		rs.poolSize = newSize
+		rs.muLookup.Unlock()
+		// Callers waiting for a frame can take the new ones
+		rs.notifyUnpin()
+		return nil
+	}
+	// Victims are only picked below poolSize, so no page moves into the frames
+	// being retired
+	rs.poolSize = newSize
+	rs.muLookup.Unlock()
+
+	for frameIdx := oldSize - 1; frameIdx >= newSize; frameIdx-- {
+		if err := rs.retireFrame(ctx, frameIdx, fm, retire); err != nil {
+			// Keep the frames that are still there
+			rs.muLookup.Lock()
+			rs.poolSize = len(rs.descs)
+			rs.muLookup.Unlock()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retireFrame waits for the last frame to be unpinned, writes its page back if
+// dirty and removes the frame. The sentinel is left in the retired frame, so a
+// caller still holding it sees ErrPageEvicted.
+func (rs *ReplacerShared) retireFrame(ctx context.Context, frameIdx int, fm file.Filer, retire func(frameIdx int)) error {
+	for {
+		rs.muLookup.Lock()
+		desc := rs.descs[frameIdx]
+		if atomic.CompareAndSwapInt32(&desc.refCount, 0, math.MinInt32) {
+			break
+		}
+		rs.muLookup.Unlock()
+
+		// Register before checking again, so an unpin in between is not missed
+		wait := rs.unpinWait()
+		if atomic.LoadInt32(&desc.refCount) == 0 {
+			continue
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", util.ErrPagePinned, ctx.Err())
+		}
+	}
+	defer rs.muLookup.Unlock()
+
+	desc := rs.descs[frameIdx]
+	if p := desc.page.Load(); p != nil {
+		if desc.dirty.Load() {
+			desc.muPin.Lock()
+			err := fm.WritePage(p)
+			desc.muPin.Unlock()
+			if err != nil {
+				atomic.StoreInt32(&desc.refCount, 0)
+				rs.notifyUnpin()
+				return err
+			}
+			desc.dirty.Store(false)
+		}
+		delete(rs.pageToIdx, p.Header.PageID)
+		// Empty, so nothing still holding the frame takes it for resident.
+		// muPin keeps a late Unpin from touching the header flags meanwhile
+		desc.page.Store(nil)
+		desc.muPin.Lock()
+		desc.buf.Header = page.PageHeader{}
+		desc.muPin.Unlock()
+		desc.version.Add(2)
+		desc.generation++
+		rs.counters.evictions.Add(1)
+	}
+
+	retire(frameIdx)
+	rs.descs = slices.Clip(rs.descs[:frameIdx])
+
+	return nil
+}
+
+// isResident reports whether the page is mapped to a frame, without pinning it.
+func (rs *ReplacerShared) isResident(pageId util.PageID) bool {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+
+	_, exist := rs.pageToIdx[pageId]
+	return exist
+}
+
 // removePageMapping removes a page from the pageToIdx map.
 func (rs *ReplacerShared) removePageMapping(pageId util.PageID) {
 	delete(rs.pageToIdx, pageId)
@@ -32,5 +283,552 @@ func (rs *ReplacerShared) getMap() map[util.PageID]int {
 }
 
 func (lr *ReplacerShared) Size() int {
+	lr.muLookup.Lock()
+	defer lr.muLookup.Unlock()
 	return lr.poolSize
 }
+
+// pinFrame takes a pin on the frame and flags its page. Policies call it from
+// Pin before recording the access. Caller must hold muLookup.
+// firstTouch reports whether a pin is the first access to a prefetched page,
+// which the policy counts like the load instead of a reuse. Caller must hold
+// muLookup.
+func (rs *ReplacerShared) firstTouch(frameIdx int) bool {
+	desc := rs.descs[frameIdx]
+	untouched := desc.untouched
+	desc.untouched = false
+	return untouched
+}
+
+func (rs *ReplacerShared) pinFrame(frameIdx int) error {
+	node := rs.descs[frameIdx]
+	if nev := atomic.AddInt32(&node.refCount, 1) < 0; nev {
+		return util.ErrPageEvicted
+	}
+
+	page := node.page.Load()
+	if page == nil {
+		return fmt.Errorf("frame %d is not allocated", frameIdx)
+	}
+
+	node.muPin.Lock()
+	if !page.Header.IsPinned() {
+		page.Header.SetPinnedFlag()
+	}
+	node.muPin.Unlock()
+
+	return nil
+}
+
+// lookup returns the frame of a resident page. A page moving in or out of a
+// frame is waited for: it is being read in, or written back and must not be
+// read from disk yet. Caller must hold muLookup, which lookup may release
+// while waiting.
+func (rs *ReplacerShared) lookup(pageId util.PageID) (int, bool) {
+	for {
+		if frameIdx, exist := rs.pageToIdx[pageId]; exist {
+			return frameIdx, true
+		}
+		done := rs.installing[pageId]
+		if done == nil {
+			return 0, false
+		}
+		rs.muLookup.Unlock()
+		<-done
+		rs.muLookup.Lock()
+	}
+}
+
+// getPage looks the page up and pins it through the policy's pin.
+func (rs *ReplacerShared) getPage(pageId util.PageID, pin func(frameIdx int) error) (*page.Page, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	frameIdx, exist := rs.lookup(pageId)
+	if !exist {
+		return nil, util.ErrPageNotFound
+	}
+
+	if err := pin(frameIdx); err != nil {
+		return nil, err
+	}
+	page := rs.descs[frameIdx].page.Load()
+	if page == nil {
+		return nil, fmt.Errorf("page id %d not found", pageId)
+	}
+
+	return page, nil
+}
+
+// shareLoaded looks for another caller that placed pageId first. A resident
+// page is pinned through the policy's pin and returned, so the caller shares
+// its frame, and a page being installed fails with pageInstalling. found is
+// false when the caller must place the page itself. Caller must hold muLookup.
+func (rs *ReplacerShared) shareLoaded(pageId util.PageID, pin func(frameIdx int) error) (p *page.Page, found bool, err error) {
+	if frameIdx, exist := rs.pageToIdx[pageId]; exist {
+		if err := pin(frameIdx); err != nil {
+			return nil, true, err
+		}
+		return rs.descs[frameIdx].page.Load(), true, nil
+	}
+	if done := rs.installing[pageId]; done != nil {
+		return nil, true, &pageInstalling{done: done}
+	}
+
+	return nil, false, nil
+}
+
+// claimVictim claims an unpinned frame for installPage with the math.MinInt32
+// sentinel, so a racing pin fails with ErrPageEvicted. It fails on a frame
+// pinned since the policy chose it, and on frames past poolSize, which a
+// shrink is retiring. Caller must hold muLookup.
+func (rs *ReplacerShared) claimVictim(frameIdx int) bool {
+	if frameIdx < 0 || frameIdx >= rs.poolSize {
+		return false
+	}
+
+	return atomic.CompareAndSwapInt32(&rs.descs[frameIdx].refCount, 0, math.MinInt32)
+}
+
+// installPage places pageId into a victim frame the policy has claimed with
+// claimVictim. muLookup is released while the old page is written
+// back if dirty and the frame's own page is filled from src in place, so the
+// I/O does not stall lookups of other pages. Meanwhile both pages are in
+// installing, and callers looking either of them up wait for the install. If
+// either step fails the frame keeps its old page. The new page is left pinned
+// once and returned. Caller must hold muLookup, which is held again on return.
+func (rs *ReplacerShared) installPage(frameIdx int, pageId util.PageID, src PageSource, fm file.Filer) (*page.Page, error) {
+	desc := rs.descs[frameIdx]
+	// The old page is overwritten in place, keep its id to unmap it
+	evicted := desc.page.Load() != nil
+	evictedId := desc.buf.Header.PageID
+
+	done := make(chan struct{})
+	rs.installing[pageId] = done
+	if evicted {
+		delete(rs.pageToIdx, evictedId)
+		rs.installing[evictedId] = done
+	}
+	// Unmapped, so flushes skip the frame, and handles to it are stale
+	desc.page.Store(nil)
+	desc.generation++
+	// The version is odd while the page is rewritten, like under a WritePageGuard
+	desc.version.Add(1)
+	rs.muLookup.Unlock()
+
+	err := rs.fillFrame(desc, pageId, src, fm)
+
+	rs.muLookup.Lock()
+	delete(rs.installing, pageId)
+	if evicted {
+		delete(rs.installing, evictedId)
+	}
+	close(done)
+	desc.version.Add(1)
+	if err != nil {
+		if evicted {
+			rs.pageToIdx[evictedId] = frameIdx
+			desc.page.Store(&desc.buf)
+		}
+		atomic.StoreInt32(&desc.refCount, 0)
+		rs.notifyUnpin()
+		return nil, err
+	}
+
+	if evicted {
+		rs.counters.evictions.Add(1)
+	}
+	rs.pageToIdx[pageId] = frameIdx
+	desc.page.Store(&desc.buf)
+	_, desc.untouched = src.(prefetched)
+
+	return &desc.buf, nil
+}
+
+// fillFrame writes the page of a claimed frame back if dirty, then reads pageId
+// into the frame from src. It runs without muLookup, the sentinel keeps the
+// frame from being pinned. On error the frame's page is left as it was.
+func (rs *ReplacerShared) fillFrame(desc *FrameDesc, pageId util.PageID, src PageSource, fm file.Filer) error {
+	// An Unpin that just dropped the last pin may still be clearing flags
+	desc.muPin.Lock()
+	defer desc.muPin.Unlock()
+
+	if desc.dirty.Load() {
+		rs.counters.dirtyEvictions.Add(1)
+		if err := fm.WritePage(&desc.buf); err != nil {
+			return err
+		}
+		desc.dirty.Store(false)
+	}
+
+	if err := src.ReadPageInto(pageId, &desc.buf); err != nil {
+		return err
+	}
+	desc.buf.Header.SetPinnedFlag()
+	// Under muPin, so a late Unpin of the old page leaves the flag alone
+	atomic.StoreInt32(&desc.refCount, 1)
+
+	return nil
+}
+
+// recycleFrame places pageId into a given frame for an access strategy ring.
+// reusable tells if the policy still considers the frame cold, recycled resets
+// the policy state for the new page. Both run under muLookup.
+func (rs *ReplacerShared) recycleFrame(frameIdx int, pageId util.PageID, src PageSource, fm file.Filer,
+	pin func(frameIdx int) error, reusable func(frameIdx int) bool, recycled func(frameIdx int)) (*page.Page, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+
+	// Another caller loaded the same page first, share its frame
+	if p, found, err := rs.shareLoaded(pageId, pin); found {
+		var installing *pageInstalling
+		if errors.As(err, &installing) {
+			// Or is loading it, RequestFree waits for it
+			return nil, util.ErrNoFreeFrame
+		}
+		return p, err
+	}
+
+	// Retired by a shrink, pinned or reused by a hot page since, the caller
+	// falls back to RequestFree
+	if frameIdx >= rs.poolSize || frameIdx < 0 {
+		return nil, util.ErrNoFreeFrame
+	}
+	if !reusable(frameIdx) || !rs.claimVictim(frameIdx) {
+		return nil, util.ErrNoFreeFrame
+	}
+
+	page, err := rs.installPage(frameIdx, pageId, src, fm)
+	if err != nil {
+		return nil, err
+	}
+	recycled(frameIdx)
+	rs.counters.recycled.Add(1)
+
+	return page, nil
+}
+
+// frameOf returns the frame holding a resident page.
+func (rs *ReplacerShared) frameOf(pageId util.PageID) (int, bool) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	frameIdx, exist := rs.pageToIdx[pageId]
+	return frameIdx, exist
+}
+
+func (rs *ReplacerShared) Unpin(pageId util.PageID, isDirty bool) error {
+	rs.muLookup.Lock()
+	frameIdx, exist := rs.pageToIdx[pageId]
+	if !exist {
+		rs.muLookup.Unlock()
+		return util.ErrPageNotFound
+	}
+	node := rs.descs[frameIdx]
+	rs.muLookup.Unlock()
+
+	return rs.unpinFrame(node, frameIdx, isDirty)
+}
+
+// unpinFrame drops a pin the caller holds on the frame.
+func (rs *ReplacerShared) unpinFrame(node *FrameDesc, frameIdx int, isDirty bool) error {
+	page := node.page.Load()
+	if page == nil {
+		return fmt.Errorf("frame %d is not allocated", frameIdx)
+	}
+
+	// Handle dirty flag first (while still pinned)
+	if isDirty {
+		node.markDirty(page)
+	}
+
+	if current := atomic.LoadInt32(&node.refCount); current <= 0 {
+		return fmt.Errorf("frame %d was not pinned", frameIdx)
+	}
+
+	if newCount := atomic.AddInt32(&node.refCount, -1); newCount == 0 {
+		node.muPin.Lock()
+		// The frame may hold another page, pinned, by the time muPin is taken
+		if atomic.LoadInt32(&node.refCount) <= 0 {
+			page.Header.ClearPinnedFlag()
+		}
+		node.muPin.Unlock()
+		rs.notifyUnpin()
+	}
+
+	return nil
+}
+
+// MarkDirty flags a resident page for write-back without releasing it.
+func (rs *ReplacerShared) MarkDirty(pageId util.PageID) error {
+	rs.muLookup.Lock()
+	frameIdx, exist := rs.pageToIdx[pageId]
+	if !exist {
+		rs.muLookup.Unlock()
+		return util.ErrPageNotFound
+	}
+	node := rs.descs[frameIdx]
+	rs.muLookup.Unlock()
+
+	page := node.page.Load()
+	if page == nil {
+		return fmt.Errorf("frame %d is not allocated", frameIdx)
+	}
+	node.markDirty(page)
+
+	return nil
+}
+
+func (node *FrameDesc) markDirty(page *page.Page) {
+	node.dirty.Store(true)
+	node.muPin.Lock()
+	page.Header.SetDirtyFlag()
+	node.muPin.Unlock()
+}
+
+func (rs *ReplacerShared) FlushPage(pageId util.PageID, fm file.Filer) error {
+	rs.muLookup.Lock()
+	frameIdx, exist := rs.lookup(pageId)
+	if !exist {
+		rs.muLookup.Unlock()
+		return util.ErrPageNotFound
+	}
+	node := rs.descs[frameIdx]
+	node.holdForFlush()
+	rs.muLookup.Unlock()
+
+	err := node.flush(fm)
+	rs.notifyUnpin()
+	return err
+}
+
+func (rs *ReplacerShared) FlushAll(fm file.Filer) error {
+	rs.muLookup.Lock()
+	descs := rs.descs
+	// Evictions writing pages back right now finish them first
+	var installs []chan struct{}
+	for _, done := range rs.installing {
+		installs = append(installs, done)
+	}
+	rs.muLookup.Unlock()
+	for _, done := range installs {
+		<-done
+	}
+
+	for _, node := range descs {
+		rs.muLookup.Lock()
+		if node.page.Load() == nil || !node.dirty.Load() {
+			rs.muLookup.Unlock()
+			continue
+		}
+		node.holdForFlush()
+		rs.muLookup.Unlock()
+
+		err := node.flush(fm)
+		rs.notifyUnpin()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeAhead flushes dirty unpinned frames in the order the policy evicts
+// them, stopping after maxPages writes. order runs under muLookup.
+func (rs *ReplacerShared) writeAhead(fm file.Filer, maxPages int, order func() []int) (int, error) {
+	rs.muLookup.Lock()
+	candidates := order()
+	rs.muLookup.Unlock()
+
+	written := 0
+	for _, frameIdx := range candidates {
+		if written >= maxPages {
+			break
+		}
+
+		rs.muLookup.Lock()
+		if frameIdx >= len(rs.descs) {
+			rs.muLookup.Unlock()
+			continue
+		}
+		node := rs.descs[frameIdx]
+		if node.page.Load() == nil || !node.dirty.Load() || atomic.LoadInt32(&node.refCount) != 0 {
+			rs.muLookup.Unlock()
+			continue
+		}
+		node.holdForFlush()
+		rs.muLookup.Unlock()
+
+		err := node.flush(fm)
+		rs.notifyUnpin()
+		if err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	return written, nil
+}
+
+// holdForFlush pins the frame without counting it as an access, so it cannot
+// be evicted once muLookup is released. Caller must hold muLookup.
+func (node *FrameDesc) holdForFlush() {
+	atomic.AddInt32(&node.refCount, 1)
+}
+
+// flush writes a frame held by holdForFlush back if dirty and releases it.
+func (node *FrameDesc) flush(fm file.Filer) error {
+	defer atomic.AddInt32(&node.refCount, -1)
+
+	page := node.page.Load()
+	if page == nil || !node.dirty.Load() {
+		return nil
+	}
+
+	// Wait for a writer holding the page through a WritePageGuard, and keep
+	// Pin/Unpin from touching header flags while the page is copied. The write
+	// runs on the copy without muPin, which lookups take under muLookup
+	node.latch.RLock()
+	node.muPin.Lock()
+	node.dirty.Store(false)
+	page.Header.ClearDirtyFlag()
+	snapshot := *page
+	node.muPin.Unlock()
+	node.latch.RUnlock()
+
+	if err := fm.WritePage(&snapshot); err != nil {
+		// A change since the copy set the flags again, restoring them is harmless
+		node.muPin.Lock()
+		node.dirty.Store(true)
+		page.Header.SetDirtyFlag()
+		node.muPin.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// deletePage empties the frame of an unpinned page. reset clears the policy's
+// own state for the frame and runs under muLookup.
+func (rs *ReplacerShared) deletePage(pageId util.PageID, reset func(frameIdx int)) error {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	frameIdx, exist := rs.lookup(pageId)
+	if !exist {
+		return util.ErrPageNotFound
+	}
+
+	node := rs.descs[frameIdx]
+	// Same sentinel as eviction, so a racing Pin sees ErrPageEvicted
+	if !atomic.CompareAndSwapInt32(&node.refCount, 0, math.MinInt32) {
+		return util.ErrPagePinned
+	}
+
+	rs.removePageMapping(pageId)
+	node.page.Store(nil)
+	node.version.Add(2)
+	node.generation++
+	node.dirty.Store(false)
+	reset(frameIdx)
+	atomic.StoreInt32(&node.refCount, 0)
+
+	return nil
+}
+
+// Latch returns the latch guarding the data of a resident page. The caller must
+// hold a pin on the page, otherwise the frame may be reused for another page.
+func (rs *ReplacerShared) Latch(pageId util.PageID) (*sync.RWMutex, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	frameIdx, exist := rs.pageToIdx[pageId]
+	if !exist {
+		return nil, util.ErrPageNotFound
+	}
+
+	return &rs.descs[frameIdx].latch, nil
+}
+
+// frameDesc returns the frame of a resident page. The caller must hold a pin
+// on the page, otherwise the frame may be reused for another page.
+func (rs *ReplacerShared) frameDesc(pageId util.PageID) (*FrameDesc, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	frameIdx, exist := rs.pageToIdx[pageId]
+	if !exist {
+		return nil, util.ErrPageNotFound
+	}
+
+	return rs.descs[frameIdx], nil
+}
+
+// handle returns a FrameHandle to the frame of a resident page.
+func (rs *ReplacerShared) handle(pageId util.PageID) (FrameHandle, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	frameIdx, exist := rs.pageToIdx[pageId]
+	if !exist {
+		return FrameHandle{}, util.ErrPageNotFound
+	}
+
+	desc := rs.descs[frameIdx]
+	return FrameHandle{pageId: pageId, frameIdx: frameIdx, generation: desc.generation, desc: desc}, nil
+}
+
+// releaseHandle unpins the page of a handle the caller has pinned. The pin
+// keeps the frame from changing, so neither muLookup nor pageToIdx is needed.
+func (rs *ReplacerShared) releaseHandle(h FrameHandle, isDirty bool) error {
+	if h.desc == nil {
+		return util.ErrStaleHandle
+	}
+	if p := h.desc.page.Load(); p == nil || p.Header.PageID != h.pageId {
+		return util.ErrStaleHandle
+	}
+
+	return rs.unpinFrame(h.desc, h.frameIdx, isDirty)
+}
+
+// pinHandle pins the page of a handle through the policy's pin, without the
+// pageToIdx lookup. It fails with ErrStaleHandle once the frame was evicted,
+// reused or retired. muLookup is still taken: eviction relies on pins only
+// growing under it, and the policy records the access under it.
+func (rs *ReplacerShared) pinHandle(h FrameHandle, pin func(frameIdx int) error) (*page.Page, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	if h.frameIdx < 0 || h.frameIdx >= rs.poolSize {
+		return nil, util.ErrStaleHandle
+	}
+
+	desc := rs.descs[h.frameIdx]
+	p := desc.page.Load()
+	if desc.generation != h.generation || p == nil || p.Header.PageID != h.pageId {
+		return nil, util.ErrStaleHandle
+	}
+	if err := pin(h.frameIdx); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// optimisticFrame returns the frame of a resident page with its page and
+// version, read together under muLookup so no page install comes in between.
+func (rs *ReplacerShared) optimisticFrame(pageId util.PageID) (*FrameDesc, *page.Page, uint64, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	frameIdx, exist := rs.pageToIdx[pageId]
+	if !exist {
+		return nil, nil, 0, util.ErrPageNotFound
+	}
+
+	desc := rs.descs[frameIdx]
+	return desc, desc.page.Load(), desc.version.Load(), nil
+}
+
+func (rs *ReplacerShared) GetPinCount(frameIdx int) (int32, error) {
+	rs.muLookup.Lock()
+	defer rs.muLookup.Unlock()
+	if frameIdx >= rs.poolSize || frameIdx < 0 {
+		return 0, fmt.Errorf("invalid frame index %d", frameIdx)
+	}
+
+	return atomic.LoadInt32(&rs.descs[frameIdx].refCount), nil
+}
@@ -0,0 +1,1078 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+/**
+* Conformance suite every Replacer must pass. A new policy only needs an entry
+* in replacerFactories to get the same coverage as the existing ones.
+**/
+type replacerFactory struct {
+	name string
+	new  func(size int) (Replacer, *ReplacerShared)
+}
+
+var replacerFactories = []replacerFactory{
+	{"Clock", func(size int) (Replacer, *ReplacerShared) {
+		shared := NewReplacerShared(size)
+		replacer := &ClockReplacer{}
+		replacer.Init(size, 3, shared)
+		return replacer, shared
+	}},
+	{"LRU-K", func(size int) (Replacer, *ReplacerShared) {
+		shared := NewReplacerShared(size)
+		replacer := &LRUKReplacer{}
+		replacer.Init(size, 2, shared)
+		return replacer, shared
+	}},
+	{"ARC", func(size int) (Replacer, *ReplacerShared) {
+		shared := NewReplacerShared(size)
+		replacer := &ARCReplacer{}
+		replacer.Init(size, shared)
+		return replacer, shared
+	}},
+}
+
+// suitePool is a buffer pool over a file holding numPages test pages.
+type suitePool struct {
+	bp       *BufferPool
+	fm       *file.FileManager
+	replacer Replacer
+	shared   *ReplacerShared
+}
+
+func newSuitePool(t *testing.T, factory replacerFactory, size int, numPages int) *suitePool {
+	t.Helper()
+	path, cleanup := util.CreateTempFile(t)
+	t.Cleanup(cleanup)
+	fm, err := file.NewFileManager(path, numPages)
+	assert.NoError(t, err, "create FileManager")
+	t.Cleanup(func() { fm.Close() })
+
+	for i := util.PageID(0); i < util.PageID(numPages); i++ {
+		testPage := &page.Page{
+			Header: page.PageHeader{PageID: i},
+		}
+		testData := fmt.Sprintf("Page %d test data", i)
+		copy(testPage.Data[:], []byte(testData))
+		assert.NoError(t, fm.WritePage(testPage), "write test page %d", i)
+	}
+
+	replacer, shared := factory.new(size)
+	return &suitePool{
+		bp:       NewBufferPool(fm, replacer, shared),
+		fm:       fm,
+		replacer: replacer,
+		shared:   shared,
+	}
+}
+
+// resident reads the mapping under muLookup.
+func (sp *suitePool) resident(pageId util.PageID) (int, bool) {
+	sp.shared.muLookup.Lock()
+	defer sp.shared.muLookup.Unlock()
+	frameIdx, exist := sp.shared.pageToIdx[pageId]
+	return frameIdx, exist
+}
+
+// blockingDeallocate frees a page once release is closed.
+type blockingDeallocate struct {
+	file.PageStore
+	started, release chan struct{}
+}
+
+func (s *blockingDeallocate) DeallocatePage(pageId util.PageID) error {
+	close(s.started)
+	<-s.release
+	return s.PageStore.DeallocatePage(pageId)
+}
+
+// blockingWrite holds WritePage until release, once started is closed.
+type blockingWrite struct {
+	file.PageStore
+	started, release chan struct{}
+}
+
+func (s *blockingWrite) WritePage(p *page.Page) error {
+	close(s.started)
+	<-s.release
+	return s.PageStore.WritePage(p)
+}
+
+// failingMarkDirty fails every MarkDirty.
+type failingMarkDirty struct {
+	Replacer
+}
+
+func (r *failingMarkDirty) MarkDirty(pageId util.PageID) error {
+	return util.ErrPageNotFound
+}
+
+// countingFiler counts the writes a replacer issues on eviction.
+type countingFiler struct {
+	file.Filer
+	writes atomic.Int32
+}
+
+func (cf *countingFiler) WritePage(p *page.Page) error {
+	cf.writes.Add(1)
+	return cf.Filer.WritePage(p)
+}
+
+func TestReplacerConformance(t *testing.T) {
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			t.Run("PinUnpinAccounting", func(t *testing.T) { testPinUnpinAccounting(t, factory) })
+			t.Run("DirtyWriteBack", func(t *testing.T) { testDirtyWriteBack(t, factory) })
+			t.Run("CleanVictimNotWritten", func(t *testing.T) { testCleanVictimNotWritten(t, factory) })
+			t.Run("EvictsOnlyUnpinned", func(t *testing.T) { testEvictsOnlyUnpinned(t, factory) })
+			t.Run("EvictedSentinel", func(t *testing.T) { testEvictedSentinel(t, factory) })
+			t.Run("AllPinned", func(t *testing.T) { testAllPinned(t, factory) })
+			t.Run("ConcurrentHit", func(t *testing.T) { testConcurrentHit(t, factory) })
+			t.Run("ConcurrentAllocation", func(t *testing.T) { testConcurrentAllocation(t, factory) })
+			t.Run("ConcurrentEviction", func(t *testing.T) { testConcurrentEviction(t, factory) })
+			t.Run("NewPage", func(t *testing.T) { testNewPage(t, factory) })
+			t.Run("NewPageFailureKeepsIds", func(t *testing.T) { testNewPageFailureKeepsIds(t, factory) })
+			t.Run("FetchPage", func(t *testing.T) { testFetchPage(t, factory) })
+			t.Run("FlushAndClose", func(t *testing.T) { testFlushAndClose(t, factory) })
+			t.Run("WriteAhead", func(t *testing.T) { testWriteAhead(t, factory) })
+			t.Run("DeletePage", func(t *testing.T) { testDeletePage(t, factory) })
+			t.Run("PageGuards", func(t *testing.T) { testPageGuards(t, factory) })
+			t.Run("FrameReusedInPlace", func(t *testing.T) { testFrameReusedInPlace(t, factory) })
+			t.Run("ReadWithoutLookupLock", func(t *testing.T) { testReadWithoutLookupLock(t, factory) })
+		})
+	}
+}
+
+func testPinUnpinAccounting(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 3, 5)
+
+	p, err := sp.bp.AllocateFrame(0)
+	assert.NoError(t, err, "allocate page 0")
+	frameIdx, exist := sp.resident(0)
+	assert.True(t, exist, "page 0 in pageToIdx")
+	pinCount, err := sp.replacer.GetPinCount(frameIdx)
+	assert.NoError(t, err, "pin count")
+	assert.Equal(t, int32(1), pinCount, "allocation pins once")
+	assert.True(t, p.Header.IsPinned(), "pinned flag set")
+
+	again, err := sp.bp.GetPage(0)
+	assert.NoError(t, err, "get page 0")
+	assert.Same(t, p, again, "hit returns the resident page")
+	pinCount, _ = sp.replacer.GetPinCount(frameIdx)
+	assert.Equal(t, int32(2), pinCount, "hit pins again")
+
+	assert.NoError(t, sp.bp.Release(0, false), "first release")
+	assert.True(t, p.Header.IsPinned(), "still pinned once")
+	assert.NoError(t, sp.bp.Release(0, false), "second release")
+	pinCount, _ = sp.replacer.GetPinCount(frameIdx)
+	assert.Equal(t, int32(0), pinCount, "every pin released")
+	assert.False(t, p.Header.IsPinned(), "pinned flag cleared")
+
+	assert.Error(t, sp.bp.Release(0, false), "release without a pin")
+	assert.ErrorIs(t, sp.bp.Release(4, false), util.ErrPageNotFound, "release of non-resident page")
+	_, err = sp.replacer.GetPinCount(-1)
+	assert.Error(t, err, "negative frame index")
+	_, err = sp.replacer.GetPinCount(3)
+	assert.Error(t, err, "frame index past the pool")
+}
+
+func testDirtyWriteBack(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 2, 4)
+
+	p, err := sp.bp.FetchPage(0)
+	assert.NoError(t, err, "fetch page 0")
+	copy(p.Data[:], []byte("dirty write back"))
+	assert.NoError(t, sp.bp.Release(0, true), "release dirty page 0")
+	frameIdx, _ := sp.resident(0)
+	assert.True(t, sp.shared.descs[frameIdx].dirty.Load(), "frame is dirty")
+
+	for i := util.PageID(1); i < 4; i++ {
+		_, err := sp.bp.FetchPage(i)
+		assert.NoError(t, err, "fetch page %d", i)
+		assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+	}
+	_, exist := sp.resident(0)
+	assert.False(t, exist, "page 0 should be evicted")
+
+	onDisk, err := sp.fm.ReadPage(0)
+	assert.NoError(t, err, "read page 0")
+	assert.Equal(t, []byte("dirty write back"), onDisk.Data[:16], "evicted dirty page is written back")
+}
+
+func testCleanVictimNotWritten(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 1, 3)
+	cf := &countingFiler{Filer: sp.fm}
+
+	load := func(pageId util.PageID) {
+		_, err := sp.replacer.RequestFree(context.Background(), pageId, cf, cf)
+		assert.NoError(t, err, "request free for page %d", pageId)
+	}
+
+	load(0)
+	assert.NoError(t, sp.replacer.Unpin(0, false), "unpin clean page 0")
+	load(1)
+	assert.Equal(t, int32(0), cf.writes.Load(), "clean victim is not written")
+
+	assert.NoError(t, sp.replacer.Unpin(1, true), "unpin dirty page 1")
+	load(2)
+	assert.Equal(t, int32(1), cf.writes.Load(), "dirty victim is written once")
+	assert.NoError(t, sp.replacer.Unpin(2, false), "unpin page 2")
+}
+
+func testEvictsOnlyUnpinned(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 3, 6)
+
+	pinned := map[util.PageID]*page.Page{}
+	for i := util.PageID(0); i < 2; i++ {
+		p, err := sp.bp.FetchPage(i)
+		assert.NoError(t, err, "fetch page %d", i)
+		pinned[i] = p
+	}
+
+	for round := 0; round < 3; round++ {
+		for i := util.PageID(2); i < 6; i++ {
+			p, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+			assert.Equal(t, i, p.Header.PageID, "correct page ID")
+			assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+		}
+	}
+
+	for pageId, p := range pinned {
+		frameIdx, exist := sp.resident(pageId)
+		assert.True(t, exist, "pinned page %d must stay resident", pageId)
+		assert.Same(t, p, sp.shared.descs[frameIdx].page.Load(), "pinned page %d keeps its frame", pageId)
+		pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+		assert.Equal(t, int32(1), pinCount, "pinned page %d keeps its pin", pageId)
+		assert.NoError(t, sp.bp.Release(pageId, false), "release page %d", pageId)
+	}
+}
+
+func testEvictedSentinel(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 2, 2)
+
+	_, err := sp.bp.AllocateFrame(0)
+	assert.NoError(t, err, "allocate page 0")
+	assert.NoError(t, sp.bp.Release(0, false), "release page 0")
+	frameIdx, _ := sp.resident(0)
+	desc := sp.shared.descs[frameIdx]
+
+	// Freeze the frame the way eviction does while it swaps the page
+	atomic.StoreInt32(&desc.refCount, math.MinInt32)
+	sp.shared.muLookup.Lock()
+	err = sp.replacer.pin(frameIdx)
+	sp.shared.muLookup.Unlock()
+	assert.ErrorIs(t, err, util.ErrPageEvicted, "pin on a frame being evicted")
+	_, err = sp.replacer.GetPage(0)
+	assert.ErrorIs(t, err, util.ErrPageEvicted, "get on a frame being evicted")
+	atomic.StoreInt32(&desc.refCount, 0)
+
+	p, err := sp.bp.FetchPage(0)
+	assert.NoError(t, err, "fetch after the frame is released")
+	assert.Equal(t, util.PageID(0), p.Header.PageID, "correct page ID")
+	assert.NoError(t, sp.bp.Release(0, false), "release page 0")
+}
+
+func testAllPinned(t *testing.T, factory replacerFactory) {
+	t.Run("GivesUpAfterSweeps", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 2, 3)
+		sp.shared.maxSweeps = 1
+		for i := util.PageID(0); i < 2; i++ {
+			_, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+		}
+
+		_, err := sp.bp.FetchPage(2)
+		assert.ErrorIs(t, err, util.ErrNoFreeFrame, "every frame is pinned")
+		_, exist := sp.resident(2)
+		assert.False(t, exist, "page 2 should not be loaded")
+		assert.Empty(t, sp.bp.loading, "failed load should be cleared")
+	})
+
+	t.Run("NoDeadlineWaitsBounded", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 2, 3)
+		sp.shared.waitTimeout = 20 * time.Millisecond
+		for i := util.PageID(0); i < 2; i++ {
+			_, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := sp.bp.FetchPage(2)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, util.ErrNoFreeFrame, "every frame is pinned")
+		case <-time.After(5 * time.Second):
+			t.Fatal("fetch without a deadline waited past the wait timeout")
+		}
+		assert.NotZero(t, sp.bp.Stats().Replacer.Waits, "waited for an unpin")
+	})
+
+	t.Run("HonorsContext", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 2, 3)
+		for i := util.PageID(0); i < 2; i++ {
+			_, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := sp.bp.FetchPageContext(ctx, 2)
+		assert.ErrorIs(t, err, util.ErrNoFreeFrame, "every frame is pinned")
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "gave up at the deadline")
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		_, err = sp.bp.NewPageContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled, "new page with a canceled context")
+	})
+
+	t.Run("WaitsForUnpin", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 2, 3)
+		for i := util.PageID(0); i < 2; i++ {
+			_, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var done atomic.Bool
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			p, err := sp.bp.FetchPageContext(ctx, 2)
+			assert.NoError(t, err, "fetch page 2 after an unpin")
+			assert.Equal(t, util.PageID(2), p.Header.PageID, "correct page ID")
+			done.Store(true)
+		})
+
+		time.Sleep(50 * time.Millisecond)
+		assert.False(t, done.Load(), "fetch should wait while every frame is pinned")
+		assert.NoError(t, sp.bp.Release(0, false), "release page 0")
+		wg.Wait()
+
+		_, exist := sp.resident(0)
+		assert.False(t, exist, "unpinned page 0 should be evicted")
+		assert.NoError(t, sp.bp.Release(2, false), "release page 2")
+		assert.NoError(t, sp.bp.Release(1, false), "release page 1")
+	})
+}
+
+func testConcurrentHit(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 3, 5)
+
+	for i := util.PageID(0); i < 3; i++ {
+		_, err := sp.bp.AllocateFrame(i)
+		assert.NoError(t, err, "allocate page %d", i)
+		assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+	}
+
+	numGoroutines := 10
+	targetPageId := util.PageID(1)
+	var wg sync.WaitGroup
+	results := make([]*page.Page, numGoroutines)
+	errors := make([]error, numGoroutines)
+	for i := range numGoroutines {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			page, err := sp.bp.GetPage(targetPageId)
+			results[index] = page
+			errors[index] = err
+			if err == nil {
+				assert.NoError(t, sp.bp.Release(targetPageId, false), "release after concurrent hit")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < numGoroutines; i++ {
+		assert.NoError(t, errors[i], "goroutine %d should not have error", i)
+		assert.Same(t, results[0], results[i], "goroutine %d should get same page instance", i)
+		assert.Equal(t, targetPageId, results[i].Header.PageID, "goroutine %d should get correct page ID", i)
+	}
+	frameIdx, exist := sp.resident(targetPageId)
+	assert.True(t, exist, "page should still be in buffer pool")
+	pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+	assert.Equal(t, int32(0), pinCount, "every pin released")
+}
+
+func testConcurrentAllocation(t *testing.T, factory replacerFactory) {
+	size := 10
+	sp := newSuitePool(t, factory, size, 2*size)
+
+	var wg sync.WaitGroup
+	for i := 0; i < size; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			pageId := util.PageID(index)
+			page, err := sp.bp.AllocateFrame(pageId)
+			assert.NoError(t, err, "allocate page %d", index)
+			assert.Equal(t, pageId, page.Header.PageID, "correct page ID")
+			assert.NoError(t, sp.bp.Release(pageId, false), "release page %d", index)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, size, len(sp.shared.pageToIdx), "buffer should be full with len %d", size)
+	for i := range size {
+		pageId := util.PageID(i)
+		frameIdx, exist := sp.resident(pageId)
+		assert.True(t, exist, "page id %d should be in the buffer", pageId)
+		desc := sp.shared.descs[frameIdx]
+		assert.Equal(t, int32(0), desc.refCount, "refCount at page %d after allocate+unpin must be 0", i)
+		assert.Equal(t, pageId, desc.page.Load().Header.PageID, "frame of page %d holds it", i)
+	}
+}
+
+// Workers race fetches of more pages than frames, so frames are evicted under
+// callers that are about to pin them and FetchPage must retry through it.
+func testConcurrentEviction(t *testing.T, factory replacerFactory) {
+	size := 10
+	numPages := 3 * size
+	sp := newSuitePool(t, factory, size, numPages)
+
+	// Fewer workers than frames, so a free frame always exists for every policy
+	numWorkers := size / 2
+	var wg sync.WaitGroup
+	for w := range numWorkers {
+		wg.Go(func() {
+			rng := rand.New(rand.NewSource(int64(w)))
+			for range 400 {
+				pageId := util.PageID(rng.Intn(numPages))
+				p, err := sp.bp.FetchPage(pageId)
+				if !assert.NoError(t, err, "fetch page %d", pageId) {
+					return
+				}
+				assert.Equal(t, pageId, p.Header.PageID, "fetched page must match the id")
+				assert.NoError(t, sp.bp.Release(pageId, rng.Intn(4) == 0), "release page %d", pageId)
+			}
+		})
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, len(sp.shared.pageToIdx), size, "never more pages than frames")
+	for pageId, frameIdx := range sp.shared.pageToIdx {
+		desc := sp.shared.descs[frameIdx]
+		assert.Equal(t, pageId, desc.page.Load().Header.PageID, "frame %d holds the mapped page", frameIdx)
+		assert.Equal(t, int32(0), desc.refCount, "frame %d has no pins left", frameIdx)
+	}
+	assert.Empty(t, sp.bp.loading, "no load should be left in flight")
+}
+
+func testNewPage(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 2, 3)
+
+	newPage, err := sp.bp.NewPage()
+	assert.NoError(t, err, "new page")
+	assert.Equal(t, util.PageID(3), newPage.Header.PageID, "new page should get the next free id")
+	assert.Equal(t, make([]byte, len(newPage.Data)), newPage.Data[:], "new page should be zeroed")
+
+	frameIdx, exist := sp.resident(newPage.Header.PageID)
+	assert.True(t, exist, "new page should be in pageToIdx")
+	assert.Equal(t, int32(1), sp.shared.descs[frameIdx].refCount, "new page should be pinned")
+	assert.True(t, sp.shared.descs[frameIdx].dirty.Load(), "new page should be dirty")
+	assert.True(t, newPage.Header.IsDirty(), "new page header should be dirty")
+
+	copy(newPage.Data[:], []byte("fresh page"))
+	// Frames are reused in place, newPage is another page once evicted
+	newPageId := newPage.Header.PageID
+	assert.NoError(t, sp.bp.Release(newPageId, true), "release new page")
+
+	// Push the new page out of the pool, which must write it back
+	for i := util.PageID(0); i < 2; i++ {
+		_, err := sp.bp.AllocateFrame(i)
+		assert.NoError(t, err, "allocate page %d", i)
+		assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+	}
+	_, exist = sp.resident(newPageId)
+	assert.False(t, exist, "new page should be evicted")
+
+	onDisk, err := sp.fm.ReadPage(newPageId)
+	assert.NoError(t, err, "read evicted new page")
+	assert.Equal(t, []byte("fresh page"), onDisk.Data[:10], "evicted new page should be written back")
+}
+
+func testNewPageFailureKeepsIds(t *testing.T, factory replacerFactory) {
+	t.Run("NoFreeFrame", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 2, 3)
+		sp.shared.maxSweeps = 1
+		for i := util.PageID(0); i < 2; i++ {
+			_, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for i := range 3 {
+			_, err := sp.bp.NewPageContext(ctx)
+			assert.ErrorIs(t, err, util.ErrNoFreeFrame, "new page %d with every frame pinned", i)
+		}
+
+		assert.NoError(t, sp.bp.Release(0, false), "release page 0")
+		newPage, err := sp.bp.NewPage()
+		assert.NoError(t, err, "new page")
+		assert.Equal(t, util.PageID(3), newPage.Header.PageID, "failed calls should not use up ids")
+	})
+
+	t.Run("MarkDirtyFails", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 2, 3)
+		sp.bp.replacer = &failingMarkDirty{Replacer: sp.replacer}
+		for i := range 3 {
+			_, err := sp.bp.NewPage()
+			assert.ErrorIs(t, err, util.ErrPageNotFound, "new page %d with mark dirty failing", i)
+		}
+		_, exist := sp.resident(3)
+		assert.False(t, exist, "failed new page should not keep a frame")
+
+		sp.bp.replacer = sp.replacer
+		newPage, err := sp.bp.NewPage()
+		assert.NoError(t, err, "new page")
+		assert.Equal(t, util.PageID(3), newPage.Header.PageID, "failed calls should not use up ids")
+	})
+}
+
+func testFetchPage(t *testing.T, factory replacerFactory) {
+	t.Run("MissThenHit", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 5)
+
+		missed, err := sp.bp.FetchPage(2)
+		assert.NoError(t, err, "fetch on miss")
+		assert.Equal(t, util.PageID(2), missed.Header.PageID, "correct page ID")
+
+		hit, err := sp.bp.FetchPage(2)
+		assert.NoError(t, err, "fetch on hit")
+		assert.Same(t, missed, hit, "hit should return the resident page")
+
+		frameIdx, _ := sp.resident(2)
+		assert.Equal(t, int32(2), sp.shared.descs[frameIdx].refCount, "both fetches should pin")
+		assert.NoError(t, sp.bp.Release(2, false))
+		assert.NoError(t, sp.bp.Release(2, false))
+		assert.Empty(t, sp.bp.loading, "no load should be left in flight")
+	})
+
+	t.Run("WaitsForInFlightLoad", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 5)
+
+		// Pretend a leader is already reading page 1 from disk
+		load := &pageLoad{done: make(chan struct{})}
+		sp.bp.muLoading.Lock()
+		sp.bp.loading[1] = load
+		sp.bp.muLoading.Unlock()
+
+		numGoroutines := 10
+		var wg sync.WaitGroup
+		results := make([]*page.Page, numGoroutines)
+		for i := range numGoroutines {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				p, err := sp.bp.FetchPage(1)
+				assert.NoError(t, err, "goroutine %d fetch", index)
+				results[index] = p
+			}(i)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		_, loaded := sp.resident(1)
+		assert.False(t, loaded, "waiters must not read the page themselves")
+
+		leaderPage, err := sp.bp.AllocateFrame(1)
+		assert.NoError(t, err, "leader load")
+		sp.bp.muLoading.Lock()
+		delete(sp.bp.loading, 1)
+		sp.bp.muLoading.Unlock()
+		close(load.done)
+		wg.Wait()
+
+		for i := range numGoroutines {
+			assert.Same(t, leaderPage, results[i], "goroutine %d should share the loaded page", i)
+		}
+		frameIdx, _ := sp.resident(1)
+		assert.Equal(t, int32(numGoroutines+1), sp.shared.descs[frameIdx].refCount, "every caller should hold a pin")
+	})
+
+	t.Run("LoadWaiterHonorsContext", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 5)
+		load := &pageLoad{done: make(chan struct{})}
+		sp.bp.muLoading.Lock()
+		sp.bp.loading[1] = load
+		sp.bp.muLoading.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := sp.bp.FetchPageContext(ctx, 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "gave up at the deadline")
+		assert.NotErrorIs(t, err, util.ErrNoFreeFrame, "no frame shortage while waiting for a load")
+	})
+
+	t.Run("ConcurrentMiss", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 5)
+
+		numGoroutines := 20
+		var wg sync.WaitGroup
+		results := make([]*page.Page, numGoroutines)
+		for i := range numGoroutines {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				p, err := sp.bp.FetchPage(4)
+				assert.NoError(t, err, "goroutine %d fetch", index)
+				results[index] = p
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range numGoroutines {
+			assert.Same(t, results[0], results[i], "goroutine %d should get the resident page", i)
+		}
+		assert.Equal(t, 1, len(sp.shared.pageToIdx), "page should occupy a single frame")
+		frameIdx, _ := sp.resident(4)
+		assert.Equal(t, int32(numGoroutines), sp.shared.descs[frameIdx].refCount, "every caller should hold a pin")
+		assert.Empty(t, sp.bp.loading, "no load should be left in flight")
+	})
+}
+
+func testFlushAndClose(t *testing.T, factory replacerFactory) {
+	t.Run("FlushPage", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		p, err := sp.bp.FetchPage(0)
+		assert.NoError(t, err, "fetch page 0")
+		copy(p.Data[:], []byte("flushed"))
+		assert.NoError(t, sp.bp.Release(0, true), "release dirty page")
+
+		frameIdx, _ := sp.resident(0)
+		assert.True(t, sp.shared.descs[frameIdx].dirty.Load(), "page should be dirty before flush")
+		assert.NoError(t, sp.bp.FlushPage(0), "flush page 0")
+		assert.False(t, sp.shared.descs[frameIdx].dirty.Load(), "flush should clear dirty")
+		assert.False(t, p.Header.IsDirty(), "flush should clear the header dirty flag")
+		assert.Equal(t, int32(0), sp.shared.descs[frameIdx].refCount, "flush should not leave a pin")
+
+		onDisk, err := sp.fm.ReadPage(0)
+		assert.NoError(t, err, "read flushed page")
+		assert.Equal(t, []byte("flushed"), onDisk.Data[:7], "flushed data should be on disk")
+
+		assert.ErrorIs(t, sp.bp.FlushPage(2), util.ErrPageNotFound, "flush of non-resident page")
+	})
+
+	t.Run("WritesWithoutPinLock", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+		p, err := sp.bp.FetchPage(0)
+		assert.NoError(t, err, "fetch page 0")
+		copy(p.Data[:], []byte("first"))
+		assert.NoError(t, sp.bp.Release(0, true), "release dirty page")
+
+		store := &blockingWrite{PageStore: sp.fm, started: make(chan struct{}), release: make(chan struct{})}
+		sp.bp.fm = store
+		flushed := make(chan error, 1)
+		go func() { flushed <- sp.bp.FlushPage(0) }()
+		<-store.started
+
+		// A hit pins the page while the write is in flight
+		fetched := make(chan error, 1)
+		go func() {
+			p, err := sp.bp.FetchPage(0)
+			if err == nil {
+				copy(p.Data[:], []byte("again"))
+				err = sp.bp.Release(0, true)
+			}
+			fetched <- err
+		}()
+		select {
+		case err := <-fetched:
+			assert.NoError(t, err, "fetch page 0 during the flush")
+		case <-time.After(5 * time.Second):
+			t.Fatal("fetch waited for the flush's write")
+		}
+		close(store.release)
+		assert.NoError(t, <-flushed, "flush page 0")
+
+		frameIdx, _ := sp.resident(0)
+		assert.True(t, sp.shared.descs[frameIdx].dirty.Load(), "change after the copy stays dirty")
+		onDisk, err := sp.fm.ReadPage(0)
+		assert.NoError(t, err, "read flushed page")
+		assert.Equal(t, []byte("first"), onDisk.Data[:5], "flush wrote the copy")
+	})
+
+	t.Run("FlushAll", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		for i := util.PageID(0); i < 3; i++ {
+			p, err := sp.bp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+			copy(p.Data[:], []byte(fmt.Sprintf("all %d", i)))
+			// Keep page 2 pinned, it must be flushed anyway
+			if i != 2 {
+				assert.NoError(t, sp.bp.Release(i, true), "release page %d", i)
+			} else {
+				assert.NoError(t, sp.replacer.MarkDirty(i), "mark page %d dirty", i)
+			}
+		}
+
+		assert.NoError(t, sp.bp.FlushAll(), "flush all")
+		for i := util.PageID(0); i < 3; i++ {
+			frameIdx, _ := sp.resident(i)
+			assert.False(t, sp.shared.descs[frameIdx].dirty.Load(), "page %d should be clean", i)
+			onDisk, err := sp.fm.ReadPage(i)
+			assert.NoError(t, err, "read page %d", i)
+			assert.Equal(t, []byte(fmt.Sprintf("all %d", i)), onDisk.Data[:5], "page %d should be on disk", i)
+		}
+		assert.NoError(t, sp.bp.Release(2, false), "release page 2")
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		p, err := sp.bp.FetchPage(1)
+		assert.NoError(t, err, "fetch page 1")
+		copy(p.Data[:], []byte("closed"))
+		assert.NoError(t, sp.bp.Release(1, true), "release page 1")
+
+		assert.NoError(t, sp.bp.Close(), "close buffer pool")
+		assert.NoError(t, sp.bp.Close(), "second close is a no-op")
+
+		onDisk, err := sp.fm.ReadPage(1)
+		assert.NoError(t, err, "read page 1")
+		assert.Equal(t, []byte("closed"), onDisk.Data[:6], "close should write dirty pages")
+
+		_, err = sp.bp.FetchPage(1)
+		assert.ErrorIs(t, err, util.ErrBufferPoolClosed, "fetch after close")
+		_, err = sp.bp.GetPage(1)
+		assert.ErrorIs(t, err, util.ErrBufferPoolClosed, "get after close")
+		_, err = sp.bp.AllocateFrame(2)
+		assert.ErrorIs(t, err, util.ErrBufferPoolClosed, "allocate after close")
+		_, err = sp.bp.NewPage()
+		assert.ErrorIs(t, err, util.ErrBufferPoolClosed, "new page after close")
+		assert.ErrorIs(t, sp.bp.FlushAll(), util.ErrBufferPoolClosed, "flush after close")
+	})
+}
+
+func testWriteAhead(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 4, 4)
+
+	for i := util.PageID(0); i < 4; i++ {
+		p, err := sp.bp.FetchPage(i)
+		assert.NoError(t, err, "fetch page %d", i)
+		copy(p.Data[:], []byte(fmt.Sprintf("ahead %d", i)))
+		// Page 3 stays pinned and must be left alone
+		if i != 3 {
+			assert.NoError(t, sp.bp.Release(i, true), "release page %d", i)
+		} else {
+			assert.NoError(t, sp.replacer.MarkDirty(i), "mark page %d dirty", i)
+		}
+	}
+
+	written, err := sp.replacer.WriteAhead(sp.fm, 2)
+	assert.NoError(t, err, "first write ahead")
+	assert.Equal(t, 2, written, "stops at the page limit")
+	written, err = sp.replacer.WriteAhead(sp.fm, 10)
+	assert.NoError(t, err, "second write ahead")
+	assert.Equal(t, 1, written, "only the last unpinned dirty page is left")
+
+	for i := util.PageID(0); i < 4; i++ {
+		frameIdx, _ := sp.resident(i)
+		assert.Equal(t, i == 3, sp.shared.descs[frameIdx].dirty.Load(), "page %d dirty flag", i)
+	}
+	onDisk, err := sp.fm.ReadPage(1)
+	assert.NoError(t, err, "read page 1")
+	assert.Equal(t, []byte("ahead 1"), onDisk.Data[:7], "written ahead page is on disk")
+
+	pinCount, _ := sp.replacer.GetPinCount(0)
+	assert.Equal(t, int32(0), pinCount, "write ahead leaves no pin")
+	assert.NoError(t, sp.bp.Release(3, false), "release page 3")
+}
+
+func testDeletePage(t *testing.T, factory replacerFactory) {
+	t.Run("Pinned", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		_, err := sp.bp.FetchPage(0)
+		assert.NoError(t, err, "fetch page 0")
+		assert.ErrorIs(t, sp.bp.DeletePage(0), util.ErrPagePinned, "pinned page cannot be deleted")
+		_, exist := sp.resident(0)
+		assert.True(t, exist, "pinned page should stay resident")
+		assert.NoError(t, sp.bp.Release(0, false), "release page 0")
+	})
+
+	t.Run("Resident", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		p, err := sp.bp.FetchPage(1)
+		assert.NoError(t, err, "fetch page 1")
+		frameIdx, _ := sp.resident(1)
+		copy(p.Data[:], []byte("deleted"))
+		assert.NoError(t, sp.bp.Release(1, true), "release page 1")
+
+		assert.NoError(t, sp.bp.DeletePage(1), "delete page 1")
+		_, exist := sp.resident(1)
+		assert.False(t, exist, "deleted page should leave the pool")
+		desc := sp.shared.descs[frameIdx]
+		assert.Nil(t, desc.page.Load(), "frame should be empty")
+		assert.False(t, desc.dirty.Load(), "frame should be clean")
+		assert.Equal(t, int32(0), desc.refCount, "frame refCount reset")
+
+		// Dirty data must not be written back, and the id is reused
+		_, err = sp.fm.ReadPage(1)
+		assert.ErrorIs(t, err, util.ErrChecksumMismatch, "deleted page should be zeroed on disk")
+		newPage, err := sp.bp.NewPage()
+		assert.NoError(t, err, "new page")
+		assert.Equal(t, util.PageID(1), newPage.Header.PageID, "deleted page id should be reused")
+		assert.NoError(t, sp.bp.Release(newPage.Header.PageID, false), "release new page")
+	})
+
+	t.Run("NotResident", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		assert.NoError(t, sp.bp.DeletePage(2), "delete page not in the pool")
+		assert.ErrorIs(t, sp.bp.DeletePage(2), util.ErrPageAlreadyFree, "page already deleted")
+	})
+
+	t.Run("ConcurrentFetch", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+		store := &blockingDeallocate{PageStore: sp.fm, started: make(chan struct{}), release: make(chan struct{})}
+		sp.bp.fm = store
+		_, err := sp.bp.FetchPage(1)
+		assert.NoError(t, err, "fetch page 1")
+		assert.NoError(t, sp.bp.Release(1, false), "release page 1")
+
+		deleted := make(chan error, 1)
+		go func() { deleted <- sp.bp.DeletePage(1) }()
+		<-store.started
+
+		// A fetch between dropping the frame and freeing the id waits for both
+		fetched := make(chan error, 1)
+		go func() {
+			_, err := sp.bp.FetchPage(1)
+			fetched <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		close(store.release)
+		assert.NoError(t, <-deleted, "delete page 1")
+		assert.ErrorIs(t, <-fetched, util.ErrChecksumMismatch, "page 1 is zeroed once deleted")
+		_, exist := sp.resident(1)
+		assert.False(t, exist, "page 1 not loaded back")
+
+		newPage, err := sp.bp.NewPage()
+		assert.NoError(t, err, "new page")
+		assert.Equal(t, util.PageID(1), newPage.Header.PageID, "deleted page id reused")
+		assert.Equal(t, make([]byte, 16), newPage.Data[:16], "new page is zeroed")
+		assert.NoError(t, sp.bp.Release(newPage.Header.PageID, false), "release new page")
+	})
+}
+
+func testPageGuards(t *testing.T, factory replacerFactory) {
+	t.Run("ReadGuard_DropReleasesPin", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		guard, err := sp.bp.FetchPageRead(0)
+		assert.NoError(t, err, "fetch read guard")
+		assert.Equal(t, util.PageID(0), guard.PageID(), "guard page id")
+		frameIdx, _ := sp.resident(0)
+		assert.Equal(t, int32(1), sp.shared.descs[frameIdx].refCount, "guard should hold a pin")
+
+		// Readers share the latch
+		other, err := sp.bp.FetchPageRead(0)
+		assert.NoError(t, err, "second read guard")
+		assert.NoError(t, other.Drop(), "drop second guard")
+
+		assert.NoError(t, guard.Drop(), "drop guard")
+		assert.NoError(t, guard.Drop(), "second drop is a no-op")
+		assert.Equal(t, int32(0), sp.shared.descs[frameIdx].refCount, "drop should release the pin")
+		assert.False(t, sp.shared.descs[frameIdx].dirty.Load(), "read guard never dirties the page")
+	})
+
+	t.Run("WriteGuard_MarksDirty", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		guard, err := sp.bp.FetchPageWrite(1)
+		assert.NoError(t, err, "fetch write guard")
+		_ = guard.Page()
+		assert.NoError(t, guard.Drop(), "drop untouched guard")
+		frameIdx, _ := sp.resident(1)
+		assert.False(t, sp.shared.descs[frameIdx].dirty.Load(), "read access through write guard stays clean")
+
+		guard, err = sp.bp.FetchPageWrite(1)
+		assert.NoError(t, err, "fetch write guard")
+		copy(guard.PageMut().Data[:], []byte("guarded"))
+		assert.NoError(t, guard.Drop(), "drop guard")
+		assert.True(t, sp.shared.descs[frameIdx].dirty.Load(), "write through guard should mark dirty")
+		assert.Equal(t, int32(0), sp.shared.descs[frameIdx].refCount, "drop should release the pin")
+	})
+
+	t.Run("WriteGuard_DropReleasesOnError", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+		sp.bp.replacer = &failingMarkDirty{Replacer: sp.replacer}
+
+		guard, err := sp.bp.FetchPageWrite(1)
+		assert.NoError(t, err, "fetch write guard")
+		_ = guard.PageMut()
+		assert.ErrorIs(t, guard.Drop(), util.ErrPageNotFound, "mark dirty failure is reported")
+		frameIdx, _ := sp.resident(1)
+		desc := sp.shared.descs[frameIdx]
+		assert.True(t, desc.latch.TryLock(), "latch released")
+		desc.latch.Unlock()
+		assert.Equal(t, int32(0), desc.refCount, "pin released")
+		assert.Zero(t, desc.version.Load()%2, "version even again")
+		assert.NoError(t, guard.Drop(), "second drop is a no-op")
+	})
+
+	t.Run("WriteGuard_Exclusive", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		writer, err := sp.bp.FetchPageWrite(2)
+		assert.NoError(t, err, "fetch write guard")
+
+		var acquired atomic.Bool
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			reader, err := sp.bp.FetchPageRead(2)
+			assert.NoError(t, err, "fetch read guard")
+			acquired.Store(true)
+			assert.Equal(t, []byte("exclusive"), reader.Page().Data[:9], "reader sees the finished write")
+			assert.NoError(t, reader.Drop(), "drop reader")
+		})
+
+		time.Sleep(50 * time.Millisecond)
+		assert.False(t, acquired.Load(), "reader must wait for the writer")
+		copy(writer.PageMut().Data[:], []byte("exclusive"))
+		assert.NoError(t, writer.Drop(), "drop writer")
+		wg.Wait()
+		assert.True(t, acquired.Load(), "reader should proceed after the writer drops")
+	})
+
+	t.Run("WriteGuard_ConcurrentWriters", func(t *testing.T) {
+		sp := newSuitePool(t, factory, 3, 3)
+
+		numGoroutines := 20
+		var wg sync.WaitGroup
+		for range numGoroutines {
+			wg.Go(func() {
+				guard, err := sp.bp.FetchPageWrite(0)
+				assert.NoError(t, err, "fetch write guard")
+				guard.PageMut().Data[0]++
+				assert.NoError(t, guard.Drop(), "drop guard")
+			})
+		}
+		wg.Wait()
+
+		guard, err := sp.bp.FetchPageRead(0)
+		assert.NoError(t, err, "fetch read guard")
+		assert.Equal(t, byte('P'+numGoroutines), guard.Page().Data[0], "writers must not lose updates")
+		assert.NoError(t, guard.Drop(), "drop guard")
+	})
+}
+
+func testFrameReusedInPlace(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 1, 3)
+
+	p0, err := sp.bp.FetchPage(0)
+	assert.NoError(t, err, "fetch page 0")
+	copy(p0.Data[:], []byte("dirty write back"))
+	assert.NoError(t, sp.bp.Release(0, true), "release page 0")
+
+	p1, err := sp.bp.FetchPage(1)
+	assert.NoError(t, err, "fetch page 1")
+	assert.Same(t, p0, p1, "the frame's own page is read into")
+	assert.Equal(t, util.PageID(1), p1.Header.PageID, "page 1 in the frame")
+	assert.Equal(t, []byte("Page 1 test data"), p1.Data[:16], "page 1 data")
+	assert.NoError(t, sp.bp.Release(1, false), "release page 1")
+	onDisk, err := sp.fm.ReadPage(0)
+	assert.NoError(t, err, "read page 0")
+	assert.Equal(t, []byte("dirty write back"), onDisk.Data[:16], "page 0 written back before the frame was reused")
+
+	// A failed read leaves the frame with its old page
+	_, err = sp.bp.FetchPage(5)
+	assert.ErrorIs(t, err, util.ErrPageOutOfBounds, "page past the end of the file")
+	frameIdx, exist := sp.resident(1)
+	assert.True(t, exist, "page 1 still resident")
+	pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+	assert.Equal(t, int32(0), pinCount, "frame released")
+	assert.Equal(t, []byte("Page 1 test data"), p1.Data[:16], "page 1 untouched")
+
+	p, err := sp.bp.FetchPage(1)
+	assert.NoError(t, err, "page 1 is a hit")
+	assert.Same(t, p1, p, "same frame")
+	assert.NoError(t, sp.bp.Release(1, false), "release page 1")
+}
+
+// blockingSource reads a page once release is closed.
+type blockingSource struct {
+	file.Filer
+	started, release chan struct{}
+}
+
+func (s *blockingSource) ReadPageInto(pageId util.PageID, dst *page.Page) error {
+	close(s.started)
+	<-s.release
+	return s.Filer.ReadPageInto(pageId, dst)
+}
+
+func testReadWithoutLookupLock(t *testing.T, factory replacerFactory) {
+	sp := newSuitePool(t, factory, 2, 3)
+	_, err := sp.bp.FetchPage(0)
+	assert.NoError(t, err, "fetch page 0")
+	assert.NoError(t, sp.bp.Release(0, false))
+
+	src := &blockingSource{Filer: sp.fm, started: make(chan struct{}), release: make(chan struct{})}
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := sp.replacer.RequestFree(context.Background(), 1, src, sp.fm)
+		loaded <- err
+	}()
+	<-src.started
+
+	// A hit on another page is not held up by the read
+	hit := make(chan error, 1)
+	go func() {
+		_, err := sp.bp.GetPage(0)
+		hit <- err
+	}()
+	select {
+	case err := <-hit:
+		assert.NoError(t, err, "hit on page 0 during the read")
+	case <-time.After(time.Second):
+		t.Fatal("hit on page 0 blocked by the read of page 1")
+	}
+	assert.NoError(t, sp.bp.Release(0, false))
+
+	// A lookup of the page being read waits for it instead of missing
+	got := make(chan *page.Page, 1)
+	go func() {
+		p, err := sp.bp.GetPage(1)
+		assert.NoError(t, err, "page 1 after its read")
+		got <- p
+	}()
+	select {
+	case <-got:
+		t.Fatal("lookup of page 1 returned before it was read")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(src.release)
+	assert.NoError(t, <-loaded, "request free for page 1")
+	p := <-got
+	assert.Equal(t, util.PageID(1), p.Header.PageID, "page 1 shared")
+	frameIdx, _ := sp.resident(1)
+	pinCount, _ := sp.replacer.GetPinCount(frameIdx)
+	assert.Equal(t, int32(2), pinCount, "loader and waiter both pinned")
+	assert.NoError(t, sp.replacer.Unpin(1, false))
+	assert.NoError(t, sp.replacer.Unpin(1, false))
+}
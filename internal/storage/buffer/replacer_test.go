@@ -0,0 +1,54 @@
+package buffer
+
+import (
+	"testing"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReplacer(t *testing.T) {
+	opts := util.DefaultOptions()
+	opts.BufferPoolSize = 8
+
+	replacer, shared, err := NewReplacer(opts)
+	assert.NoError(t, err, "default options")
+	assert.IsType(t, &ClockReplacer{}, replacer, "clock is the default policy")
+	assert.Equal(t, opts.ClockMaxLoop, replacer.(*ClockReplacer).maxLoop, "clock max loop")
+	assert.Equal(t, 8, shared.Size(), "pool size")
+	assert.Equal(t, opts.FrameWaitSweeps, shared.maxSweeps, "frame wait sweeps")
+
+	opts.Replacer = util.ReplacerLRUK
+	replacer, _, err = NewReplacer(opts)
+	assert.NoError(t, err, "lru-k options")
+	assert.IsType(t, &LRUKReplacer{}, replacer, "lru-k policy")
+	assert.Equal(t, opts.LRUK, replacer.(*LRUKReplacer).k, "lru-k k")
+
+	opts.Replacer = util.ReplacerARC
+	replacer, _, err = NewReplacer(opts)
+	assert.NoError(t, err, "arc options")
+	assert.IsType(t, &ARCReplacer{}, replacer, "arc policy")
+
+	opts.Replacer = util.ReplacerPolicy(99)
+	_, _, err = NewReplacer(opts)
+	assert.ErrorIs(t, err, util.ErrUnknownReplacer, "unknown policy")
+
+	opts.Replacer = util.ReplacerLRUK
+	opts.LRUK = 0
+	_, _, err = NewReplacer(opts)
+	assert.ErrorIs(t, err, util.ErrInvalidLRUK, "lru-k without history")
+
+	opts.LRUK = 2
+	opts.FrameWaitSweeps = 0
+	_, _, err = NewReplacer(opts)
+	assert.ErrorIs(t, err, util.ErrInvalidWaitSweeps, "no sweeps")
+
+	opts.FrameWaitSweeps = 4
+	opts.FrameWaitTimeout = 0
+	_, _, err = NewReplacer(opts)
+	assert.ErrorIs(t, err, util.ErrInvalidWaitTimeout, "no wait timeout")
+
+	opts.BufferPoolSize = 0
+	_, _, err = NewReplacer(opts)
+	assert.ErrorIs(t, err, util.ErrInvalidPoolSize, "empty pool")
+}
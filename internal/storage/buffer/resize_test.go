@@ -0,0 +1,215 @@
+package buffer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResize(t *testing.T) {
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			t.Run("Grow", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 2, 6)
+				for i := util.PageID(0); i < 2; i++ {
+					_, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d", i)
+				}
+
+				// Every frame is pinned, the waiting fetch takes a new frame
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				done := make(chan error, 1)
+				go func() {
+					_, err := sp.bp.FetchPageContext(ctx, 2)
+					done <- err
+				}()
+				assert.NoError(t, sp.bp.Resize(context.Background(), 5), "grow to 5 frames")
+				assert.NoError(t, <-done, "fetch after growing")
+				assert.Equal(t, 5, sp.shared.Size(), "pool size")
+
+				for i := util.PageID(3); i < 5; i++ {
+					_, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d into a new frame", i)
+				}
+				for i := util.PageID(0); i < 5; i++ {
+					_, exist := sp.resident(i)
+					assert.True(t, exist, "page %d resident", i)
+					assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+				}
+			})
+
+			t.Run("ShrinkWritesBack", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 4, 4)
+				for i := util.PageID(0); i < 4; i++ {
+					p, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d", i)
+					copy(p.Data[:], []byte("resized"))
+					assert.NoError(t, sp.bp.Release(i, true), "release page %d", i)
+				}
+
+				assert.NoError(t, sp.bp.Resize(context.Background(), 2), "shrink to 2 frames")
+				assert.Equal(t, 2, sp.shared.Size(), "pool size")
+				assert.Len(t, sp.shared.descs, 2, "retired frames removed")
+
+				resident := 0
+				for i := util.PageID(0); i < 4; i++ {
+					if frameIdx, exist := sp.resident(i); exist {
+						assert.Less(t, frameIdx, 2, "page %d in a remaining frame", i)
+						resident++
+						continue
+					}
+					onDisk, err := sp.fm.ReadPage(i)
+					assert.NoError(t, err, "read page %d", i)
+					assert.Equal(t, []byte("resized"), onDisk.Data[:7], "retired dirty page %d written back", i)
+				}
+				assert.Equal(t, 2, resident, "pages of the remaining frames stay resident")
+
+				// The pool keeps working with the remaining frames
+				for i := util.PageID(0); i < 4; i++ {
+					p, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d after shrinking", i)
+					assert.Equal(t, []byte("resized"), p.Data[:7], "page %d content", i)
+					assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+				}
+			})
+
+			t.Run("ShrinkWaitsForUnpin", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 2, 2)
+				for i := util.PageID(0); i < 2; i++ {
+					_, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d", i)
+				}
+				frameIdx, _ := sp.resident(1)
+				pinned := util.PageID(1)
+				if frameIdx == 0 {
+					pinned = 0
+				}
+				assert.NoError(t, sp.bp.Release(1-pinned, false), "release the other page")
+
+				done := make(chan error, 1)
+				go func() { done <- sp.bp.Resize(context.Background(), 1) }()
+				select {
+				case err := <-done:
+					t.Fatalf("shrink returned while the last frame was pinned: %v", err)
+				case <-time.After(20 * time.Millisecond):
+				}
+
+				assert.NoError(t, sp.bp.Release(pinned, false), "release the pinned page")
+				assert.NoError(t, <-done, "shrink after the unpin")
+				assert.Equal(t, 1, sp.shared.Size(), "pool size")
+				_, exist := sp.resident(pinned)
+				assert.False(t, exist, "page of the retired frame left the pool")
+			})
+
+			t.Run("ShrinkAborted", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 3, 3)
+				for i := util.PageID(0); i < 3; i++ {
+					_, err := sp.bp.FetchPage(i)
+					assert.NoError(t, err, "fetch page %d", i)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				err := sp.bp.Resize(ctx, 1)
+				assert.ErrorIs(t, err, util.ErrPagePinned, "pinned frames are not retired")
+				assert.ErrorIs(t, err, context.DeadlineExceeded, "context error kept")
+				assert.Equal(t, 3, sp.shared.Size(), "pool keeps its frames")
+
+				for i := util.PageID(0); i < 3; i++ {
+					assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+				}
+				_, err = sp.bp.FetchPage(2)
+				assert.NoError(t, err, "pool still usable")
+				assert.NoError(t, sp.bp.Release(2, false))
+			})
+
+			t.Run("ConcurrentFetches", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 8, 32)
+				ctx := context.Background()
+
+				var wg sync.WaitGroup
+				stop := make(chan struct{})
+				for g := 0; g < 4; g++ {
+					wg.Add(1)
+					go func(g int) {
+						defer wg.Done()
+						for i := 0; ; i++ {
+							select {
+							case <-stop:
+								return
+							default:
+							}
+							pageId := util.PageID((g*7 + i) % 32)
+							p, err := sp.bp.FetchPageContext(ctx, pageId)
+							if !assert.NoError(t, err, "fetch page %d", pageId) {
+								return
+							}
+							assert.Equal(t, pageId, p.Header.PageID, "correct page")
+							assert.NoError(t, sp.bp.Release(pageId, false), "release page %d", pageId)
+						}
+					}(g)
+				}
+
+				for _, size := range []int{4, 12, 6, 16, 8} {
+					assert.NoError(t, sp.bp.Resize(ctx, size), "resize to %d", size)
+				}
+				close(stop)
+				wg.Wait()
+
+				assert.Equal(t, 8, sp.shared.Size(), "final pool size")
+				sp.shared.muLookup.Lock()
+				for pageId, frameIdx := range sp.shared.pageToIdx {
+					assert.Less(t, frameIdx, 8, "page %d in a live frame", pageId)
+				}
+				sp.shared.muLookup.Unlock()
+			})
+
+			t.Run("ConcurrentFrames", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 8, 8)
+				ctx := context.Background()
+
+				stop := make(chan struct{})
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						for info := range sp.replacer.Frames() {
+							if info.Resident {
+								assert.Less(t, info.FrameIdx, 8, "frame in range")
+							}
+						}
+					}
+				}()
+
+				for range 200 {
+					for i := util.PageID(0); i < 8; i++ {
+						_, err := sp.bp.FetchPage(i)
+						assert.NoError(t, err, "fetch page %d", i)
+						assert.NoError(t, sp.bp.Release(i, false), "release page %d", i)
+					}
+					assert.NoError(t, sp.bp.Resize(ctx, 2), "shrink")
+					assert.NoError(t, sp.bp.Resize(ctx, 8), "grow")
+				}
+				close(stop)
+				<-done
+			})
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 2, 1)
+		assert.ErrorIs(t, sp.bp.Resize(context.Background(), 0), util.ErrInvalidPoolSize)
+		assert.NoError(t, sp.bp.Close())
+		assert.ErrorIs(t, sp.bp.Resize(context.Background(), 4), util.ErrBufferPoolClosed)
+	})
+}
@@ -0,0 +1,349 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* ShardedBufferPool splits the frames across independent BufferPools. A page id
+* always hashes to the same shard, and each shard has its own pageToIdx,
+* muLookup and replacer state, so lookups of pages in different shards never
+* contend. All shards share the file manager, or file set. A shard only evicts
+* among its own frames, so a skewed workload may evict in one shard while
+* another still has free frames.
+**/
+type ShardedBufferPool struct {
+	fm        file.PageStore
+	shards    []*BufferPool
+	closed    atomic.Bool
+	readAhead atomic.Pointer[readAhead] // detects scans across shards, nil unless enabled
+}
+
+// NewShardedBufferPool splits opts.BufferPoolSize frames over
+// opts.BufferPoolShards shards, each running the replacer selected in opts.
+func NewShardedBufferPool(fm file.PageStore, opts util.Options) (*ShardedBufferPool, error) {
+	numShards := opts.BufferPoolShards
+	if numShards <= 0 {
+		return nil, util.ErrInvalidShardCount
+	}
+	if opts.BufferPoolSize < numShards {
+		return nil, util.ErrInvalidPoolSize
+	}
+
+	sbp := &ShardedBufferPool{
+		fm:     fm,
+		shards: make([]*BufferPool, numShards),
+	}
+	for i := range sbp.shards {
+		shardOpts := opts
+		shardOpts.BufferPoolSize = opts.BufferPoolSize / numShards
+		if i < opts.BufferPoolSize%numShards {
+			shardOpts.BufferPoolSize++
+		}
+
+		replacer, shared, err := NewReplacer(shardOpts)
+		if err != nil {
+			return nil, err
+		}
+		sbp.shards[i] = NewBufferPool(fm, replacer, shared)
+	}
+
+	return sbp, nil
+}
+
+// shard returns the pool owning pageId.
+func (sbp *ShardedBufferPool) shard(pageId util.PageID) *BufferPool {
+	return sbp.shards[sbp.shardIdx(pageId)]
+}
+
+// shardIdx returns the index of the shard owning pageId. Fibonacci hashing
+// spreads sequential and strided ids evenly over the shards.
+func (sbp *ShardedBufferPool) shardIdx(pageId util.PageID) int {
+	h := uint64(pageId) * 0x9E3779B97F4A7C15
+	return int((h >> 32) % uint64(len(sbp.shards)))
+}
+
+func (sbp *ShardedBufferPool) NumShards() int {
+	return len(sbp.shards)
+}
+
+// Size is the total number of frames across all shards.
+func (sbp *ShardedBufferPool) Size() int {
+	size := 0
+	for _, bp := range sbp.shards {
+		size += bp.rs.Size()
+	}
+	return size
+}
+
+// NewPage allocates a page id in the file and places the page in its shard,
+// pinned and dirty.
+func (sbp *ShardedBufferPool) NewPage() (*page.Page, error) {
+	return sbp.NewPageContext(context.Background())
+}
+
+func (sbp *ShardedBufferPool) NewPageContext(ctx context.Context) (*page.Page, error) {
+	return sbp.NewPageWith(ctx, nil)
+}
+
+// NewPageWith is NewPageContext placing the page through the strategy's ring
+// of its shard. A nil strategy uses the whole shard.
+func (sbp *ShardedBufferPool) NewPageWith(ctx context.Context, strategy *ShardedAccessStrategy) (*page.Page, error) {
+	if sbp.closed.Load() {
+		return nil, util.ErrBufferPoolClosed
+	}
+
+	pageId, err := sbp.fm.AllocatePage()
+	if err != nil {
+		return nil, err
+	}
+
+	shardIdx := sbp.shardIdx(pageId)
+	return sbp.shards[shardIdx].newPageAt(ctx, pageId, strategy.of(shardIdx))
+}
+
+func (sbp *ShardedBufferPool) NewPageIn(ctx context.Context, fileId util.FileID) (*page.Page, error) {
+	if sbp.closed.Load() {
+		return nil, util.ErrBufferPoolClosed
+	}
+
+	pageId, err := allocatePageIn(sbp.fm, fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	return sbp.shard(pageId).newPageAt(ctx, pageId, nil)
+}
+
+func (sbp *ShardedBufferPool) FetchPage(pageId util.PageID) (*page.Page, error) {
+	sbp.readAheadOf(pageId)
+	return sbp.shard(pageId).FetchPage(pageId)
+}
+
+func (sbp *ShardedBufferPool) FetchPageContext(ctx context.Context, pageId util.PageID) (*page.Page, error) {
+	sbp.readAheadOf(pageId)
+	return sbp.shard(pageId).FetchPageContext(ctx, pageId)
+}
+
+// FetchPageWith is FetchPageContext loading misses through the strategy's ring
+// of the page's shard. A nil strategy uses the whole shard.
+func (sbp *ShardedBufferPool) FetchPageWith(ctx context.Context, pageId util.PageID, strategy *ShardedAccessStrategy) (*page.Page, error) {
+	sbp.readAheadOf(pageId)
+	shardIdx := sbp.shardIdx(pageId)
+	return sbp.shards[shardIdx].FetchPageWith(ctx, pageId, strategy.of(shardIdx))
+}
+
+func (sbp *ShardedBufferPool) FetchPageRead(pageId util.PageID) (*ReadPageGuard, error) {
+	sbp.readAheadOf(pageId)
+	return sbp.shard(pageId).FetchPageRead(pageId)
+}
+
+func (sbp *ShardedBufferPool) FetchPageWrite(pageId util.PageID) (*WritePageGuard, error) {
+	sbp.readAheadOf(pageId)
+	return sbp.shard(pageId).FetchPageWrite(pageId)
+}
+
+// EnableReadAhead detects sequential fetches over the whole pool. Consecutive
+// ids live in different shards, so the shards' own detectors would never see
+// a scan.
+func (sbp *ShardedBufferPool) EnableReadAhead(opts util.Options) error {
+	ra, err := newReadAhead(opts.ReadAheadPages)
+	if err != nil {
+		return err
+	}
+
+	sbp.readAhead.Store(ra)
+	return nil
+}
+
+func (sbp *ShardedBufferPool) DisableReadAhead() {
+	sbp.readAhead.Store(nil)
+}
+
+func (sbp *ShardedBufferPool) readAheadOf(pageId util.PageID) {
+	if ra := sbp.readAhead.Load(); ra != nil {
+		if ids := ra.next(pageId); len(ids) > 0 {
+			_ = sbp.Prefetch(ids)
+		}
+	}
+}
+
+// Prefetch hands every shard its share of the pages, see BufferPool.Prefetch.
+func (sbp *ShardedBufferPool) Prefetch(ids []util.PageID) error {
+	if sbp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+
+	byShard := make(map[*BufferPool][]util.PageID)
+	for _, pageId := range ids {
+		bp := sbp.shard(pageId)
+		byShard[bp] = append(byShard[bp], pageId)
+	}
+	for bp, shardIds := range byShard {
+		if err := bp.Prefetch(shardIds); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sbp *ShardedBufferPool) OptimisticRead(pageId util.PageID) (OptimisticRead, error) {
+	return sbp.shard(pageId).OptimisticRead(pageId)
+}
+
+func (sbp *ShardedBufferPool) ReadOptimistic(pageId util.PageID, read func(p *page.Page) error) error {
+	return sbp.shard(pageId).ReadOptimistic(pageId, read)
+}
+
+func (sbp *ShardedBufferPool) Handle(pageId util.PageID) (FrameHandle, error) {
+	return sbp.shard(pageId).Handle(pageId)
+}
+
+// FetchHandle routes the handle by its page id, see BufferPool.FetchHandle.
+func (sbp *ShardedBufferPool) FetchHandle(h FrameHandle) (*page.Page, FrameHandle, error) {
+	return sbp.shard(h.pageId).FetchHandle(h)
+}
+
+func (sbp *ShardedBufferPool) ReleaseHandle(h FrameHandle, isDirty bool) error {
+	return sbp.shard(h.pageId).ReleaseHandle(h, isDirty)
+}
+
+func (sbp *ShardedBufferPool) GetPage(pageId util.PageID) (*page.Page, error) {
+	return sbp.shard(pageId).GetPage(pageId)
+}
+
+func (sbp *ShardedBufferPool) Release(pageId util.PageID, isDirty bool) error {
+	return sbp.shard(pageId).Release(pageId, isDirty)
+}
+
+func (sbp *ShardedBufferPool) FlushPage(pageId util.PageID) error {
+	return sbp.shard(pageId).FlushPage(pageId)
+}
+
+func (sbp *ShardedBufferPool) DeletePage(pageId util.PageID) error {
+	return sbp.shard(pageId).DeletePage(pageId)
+}
+
+// Resize spreads newSize frames over the shards the way NewShardedBufferPool
+// does and resizes each shard in turn, stopping at the first error.
+func (sbp *ShardedBufferPool) Resize(ctx context.Context, newSize int) error {
+	if sbp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+	numShards := len(sbp.shards)
+	if newSize < numShards {
+		return util.ErrInvalidPoolSize
+	}
+
+	for i, bp := range sbp.shards {
+		shardSize := newSize / numShards
+		if i < newSize%numShards {
+			shardSize++
+		}
+		if err := bp.Resize(ctx, shardSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FlushAll writes back every dirty frame of every shard.
+func (sbp *ShardedBufferPool) FlushAll() error {
+	for _, bp := range sbp.shards {
+		if err := bp.FlushAll(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartBackgroundWriter starts one background writer per shard.
+func (sbp *ShardedBufferPool) StartBackgroundWriter(opts util.Options) error {
+	for i, bp := range sbp.shards {
+		if err := bp.StartBackgroundWriter(opts); err != nil {
+			for _, started := range sbp.shards[:i] {
+				started.StopBackgroundWriter()
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BgWriterStats sums the background writer stats of every shard.
+func (sbp *ShardedBufferPool) BgWriterStats() BgWriterStats {
+	var total BgWriterStats
+	for _, bp := range sbp.shards {
+		total.add(bp.BgWriterStats())
+	}
+
+	return total
+}
+
+// EnablePinDebug turns the pin debug mode on in every shard, or in none.
+func (sbp *ShardedBufferPool) EnablePinDebug(maxAge time.Duration, report func(PinLeak)) error {
+	if sbp.closed.Load() {
+		return util.ErrBufferPoolClosed
+	}
+
+	for i, bp := range sbp.shards {
+		if err := bp.EnablePinDebug(maxAge, report); err != nil {
+			for _, enabled := range sbp.shards[:i] {
+				enabled.disablePinDebug()
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PinLeaks returns the pins still held in every shard, oldest first.
+func (sbp *ShardedBufferPool) PinLeaks() []PinLeak {
+	var leaks []PinLeak
+	for _, bp := range sbp.shards {
+		leaks = append(leaks, bp.PinLeaks()...)
+	}
+	sort.Slice(leaks, func(a, b int) bool {
+		return leaks[a].PinnedAt.Before(leaks[b].PinnedAt)
+	})
+
+	return leaks
+}
+
+// Stats sums the stats of every shard.
+func (sbp *ShardedBufferPool) Stats() BufferPoolStats {
+	var total BufferPoolStats
+	for _, bp := range sbp.shards {
+		total.add(bp.Stats())
+	}
+
+	return total
+}
+
+// Close closes every shard, even if one of them fails, and returns the
+// errors joined.
+func (sbp *ShardedBufferPool) Close() error {
+	if !sbp.closed.CompareAndSwap(false, true) {
+		return nil // Idempotent
+	}
+
+	var errs []error
+	for _, bp := range sbp.shards {
+		errs = append(errs, bp.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,263 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newShardedTestPool(t testing.TB, poolSize int, numShards int, numPages int) (*ShardedBufferPool, *file.FileManager) {
+	path := fmt.Sprintf("%s/sharded.dat", t.TempDir())
+	fm, err := file.NewFileManager(path, numPages)
+	if err != nil {
+		t.Fatalf("create FileManager: %v", err)
+	}
+	t.Cleanup(func() { fm.Close() })
+	for i := util.PageID(0); i < util.PageID(numPages); i++ {
+		testPage := &page.Page{Header: page.PageHeader{PageID: i}}
+		copy(testPage.Data[:], []byte(fmt.Sprintf("Page %d test data", i)))
+		if err := fm.WritePage(testPage); err != nil {
+			t.Fatalf("write page %d: %v", i, err)
+		}
+	}
+
+	opts := util.DefaultOptions()
+	opts.BufferPoolSize = poolSize
+	opts.BufferPoolShards = numShards
+	sbp, err := NewShardedBufferPool(fm, opts)
+	if err != nil {
+		t.Fatalf("create sharded pool: %v", err)
+	}
+	return sbp, fm
+}
+
+func TestShardedBufferPool(t *testing.T) {
+	t.Run("InvalidOptions", func(t *testing.T) {
+		opts := util.DefaultOptions()
+		opts.BufferPoolShards = 0
+		_, err := NewShardedBufferPool(nil, opts)
+		assert.ErrorIs(t, err, util.ErrInvalidShardCount, "zero shards")
+
+		opts.BufferPoolShards = 4
+		opts.BufferPoolSize = 3
+		_, err = NewShardedBufferPool(nil, opts)
+		assert.ErrorIs(t, err, util.ErrInvalidPoolSize, "fewer frames than shards")
+	})
+
+	t.Run("SplitsFrames", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 10, 4, 1)
+		assert.Equal(t, 4, sbp.NumShards(), "shard count")
+		assert.Equal(t, 10, sbp.Size(), "every frame assigned to a shard")
+		for i, bp := range sbp.shards {
+			expected := 2
+			if i < 2 {
+				expected = 3
+			}
+			assert.Equal(t, expected, bp.rs.Size(), "shard %d size", i)
+		}
+	})
+
+	t.Run("Resize", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 10, 4, 1)
+		assert.ErrorIs(t, sbp.Resize(context.Background(), 3), util.ErrInvalidPoolSize, "fewer frames than shards")
+		assert.NoError(t, sbp.Resize(context.Background(), 13), "grow")
+		assert.Equal(t, 13, sbp.Size(), "grown size")
+		assert.Equal(t, 4, sbp.shards[0].rs.Size(), "remainder goes to the first shards")
+		assert.NoError(t, sbp.Resize(context.Background(), 5), "shrink")
+		assert.Equal(t, 5, sbp.Size(), "shrunk size")
+	})
+
+	t.Run("ReadAheadAcrossShards", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 32, 4, 16)
+		assert.NoError(t, sbp.EnableReadAhead(readAheadOptions(8)), "enable read-ahead")
+		for i := util.PageID(0); i < 3; i++ {
+			_, err := sbp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+			assert.NoError(t, sbp.Release(i, false), "release page %d", i)
+		}
+		for _, bp := range sbp.shards {
+			bp.prefetching.Wait()
+		}
+
+		for i := util.PageID(3); i < 7; i++ {
+			assert.True(t, sbp.shard(i).rs.isResident(i), "page %d read ahead into its shard", i)
+		}
+		assert.Equal(t, uint64(4), sbp.Stats().Prefetched, "prefetched pages counted")
+	})
+
+	t.Run("RoutesPagesToOneShard", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 64, 4, 32)
+		used := map[*BufferPool]int{}
+		for i := util.PageID(0); i < 32; i++ {
+			p, err := sbp.FetchPage(i)
+			assert.NoError(t, err, "fetch page %d", i)
+			assert.Equal(t, i, p.Header.PageID, "correct page ID")
+
+			owner := sbp.shard(i)
+			used[owner]++
+			_, exist := owner.rs.frameOf(i)
+			assert.True(t, exist, "page %d resident in its shard", i)
+			for _, bp := range sbp.shards {
+				if bp != owner {
+					_, exist := bp.rs.frameOf(i)
+					assert.False(t, exist, "page %d only in its shard", i)
+				}
+			}
+			assert.NoError(t, sbp.Release(i, false), "release page %d", i)
+		}
+		assert.Len(t, used, 4, "sequential ids should reach every shard")
+	})
+
+	t.Run("AccessStrategy", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 64, 4, 200)
+		strategy := sbp.NewAccessStrategy(BulkRead)
+		assert.Equal(t, 8, strategy.RingSize(), "a ring of an eighth of each shard")
+
+		for round := 0; round < 2; round++ {
+			for i := util.PageID(0); i < 16; i++ {
+				_, err := sbp.FetchPage(i)
+				assert.NoError(t, err, "fetch hot page %d", i)
+				assert.NoError(t, sbp.Release(i, false), "release hot page %d", i)
+			}
+		}
+
+		// Each shard recycles its own ring, no shard runs out of frames
+		for i := util.PageID(16); i < 200; i++ {
+			p, err := sbp.FetchPageWith(context.Background(), i, strategy)
+			assert.NoError(t, err, "scan page %d", i)
+			assert.Equal(t, i, p.Header.PageID, "correct page ID")
+			assert.NoError(t, sbp.Release(i, false), "release scan page %d", i)
+		}
+		for i := util.PageID(0); i < 16; i++ {
+			_, exist := sbp.shard(i).rs.frameOf(i)
+			assert.True(t, exist, "hot page %d should survive the scan", i)
+		}
+
+		newPage, err := sbp.NewPageWith(context.Background(), strategy)
+		assert.NoError(t, err, "new page through the strategy")
+		assert.NoError(t, sbp.Release(newPage.Header.PageID, true), "release new page")
+		_, err = sbp.FetchPageWith(context.Background(), 0, nil)
+		assert.NoError(t, err, "nil strategy uses the whole shard")
+		assert.NoError(t, sbp.Release(0, false), "release page 0")
+	})
+
+	t.Run("NewPageFlushAndClose", func(t *testing.T) {
+		sbp, fm := newShardedTestPool(t, 8, 2, 4)
+
+		newPage, err := sbp.NewPage()
+		assert.NoError(t, err, "new page")
+		assert.Equal(t, util.PageID(4), newPage.Header.PageID, "next free id")
+		copy(newPage.Data[:], []byte("sharded"))
+		assert.NoError(t, sbp.Release(newPage.Header.PageID, true), "release new page")
+
+		guard, err := sbp.FetchPageWrite(1)
+		assert.NoError(t, err, "fetch write guard")
+		copy(guard.PageMut().Data[:], []byte("guarded"))
+		assert.NoError(t, guard.Drop(), "drop guard")
+
+		assert.NoError(t, sbp.Close(), "close")
+		assert.NoError(t, sbp.Close(), "second close is a no-op")
+		onDisk, err := fm.ReadPage(4)
+		assert.NoError(t, err, "read new page")
+		assert.Equal(t, []byte("sharded"), onDisk.Data[:7], "new page written on close")
+		onDisk, err = fm.ReadPage(1)
+		assert.NoError(t, err, "read page 1")
+		assert.Equal(t, []byte("guarded"), onDisk.Data[:7], "guarded write flushed on close")
+
+		_, err = sbp.NewPage()
+		assert.ErrorIs(t, err, util.ErrBufferPoolClosed, "new page after close")
+		_, err = sbp.FetchPage(0)
+		assert.ErrorIs(t, err, util.ErrBufferPoolClosed, "fetch after close")
+	})
+
+	t.Run("DeletePage", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 8, 2, 4)
+
+		_, err := sbp.FetchPage(2)
+		assert.NoError(t, err, "fetch page 2")
+		assert.ErrorIs(t, sbp.DeletePage(2), util.ErrPagePinned, "pinned page")
+		assert.NoError(t, sbp.Release(2, false), "release page 2")
+		assert.NoError(t, sbp.DeletePage(2), "delete page 2")
+
+		newPage, err := sbp.NewPage()
+		assert.NoError(t, err, "new page")
+		assert.Equal(t, util.PageID(2), newPage.Header.PageID, "deleted id reused")
+		assert.NoError(t, sbp.Release(2, false), "release new page")
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		sbp, _ := newShardedTestPool(t, 32, 4, 64)
+
+		var wg sync.WaitGroup
+		for w := range 4 {
+			wg.Go(func() {
+				rng := rand.New(rand.NewSource(int64(w)))
+				for range 500 {
+					pageId := util.PageID(rng.Intn(64))
+					p, err := sbp.FetchPage(pageId)
+					if !assert.NoError(t, err, "fetch page %d", pageId) {
+						return
+					}
+					assert.Equal(t, pageId, p.Header.PageID, "fetched page must match the id")
+					assert.NoError(t, sbp.Release(pageId, false), "release page %d", pageId)
+				}
+			})
+		}
+		wg.Wait()
+
+		for i, bp := range sbp.shards {
+			for frameIdx := range bp.rs.descs {
+				pinCount, _ := bp.replacer.GetPinCount(frameIdx)
+				assert.Equal(t, int32(0), pinCount, "shard %d frame %d unpinned", i, frameIdx)
+			}
+		}
+	})
+}
+
+// BenchmarkShardedPoolHits measures hit throughput while GOMAXPROCS grows. With
+// one shard every lookup serializes on a single muLookup, with more shards the
+// lookups spread over independent locks.
+func BenchmarkShardedPoolHits(b *testing.B) {
+	const (
+		poolSize = 1024
+		numPages = 768
+	)
+
+	for _, procs := range []int{1, 2, 4, 8} {
+		for _, numShards := range []int{1, 16} {
+			b.Run(fmt.Sprintf("procs=%d/shards=%d", procs, numShards), func(b *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+				sbp, _ := newShardedTestPool(b, poolSize, numShards, numPages)
+				for i := util.PageID(0); i < numPages; i++ {
+					if _, err := sbp.FetchPage(i); err != nil {
+						b.Fatalf("warm page %d: %v", i, err)
+					}
+					sbp.Release(i, false)
+				}
+
+				var seed atomic.Int64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rng := rand.New(rand.NewSource(seed.Add(1)))
+					for pb.Next() {
+						pageId := util.PageID(rng.Intn(numPages))
+						if _, err := sbp.FetchPage(pageId); err != nil {
+							b.Errorf("fetch page %d: %v", pageId, err)
+							return
+						}
+						sbp.Release(pageId, false)
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package buffer
+
+import (
+	"iter"
+	"sync/atomic"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+// ReplacerStats is a snapshot of the work done by a replacement policy.
+type ReplacerStats struct {
+	Requests       uint64 // RequestFree calls
+	Recycled       uint64 // pages placed in an access strategy ring frame by RequestFrame
+	Evictions      uint64 // victims that held a page
+	DirtyEvictions uint64 // victims written back by the eviction itself
+	ScanSteps      uint64 // frames examined looking for victims, clock hand steps for Clock
+	Waits          uint64 // waits for an unpin while every frame was pinned
+	NoFreeFrame    uint64 // RequestFree calls that gave up with ErrNoFreeFrame
+}
+
+// BufferPoolStats is a snapshot of the pool counters and its replacer's.
+type BufferPoolStats struct {
+	Hits                uint64 // fetches served by a resident page
+	Misses              uint64 // fetches that read the page from disk
+	LoadWaits           uint64 // fetches that waited for another caller's disk read
+	NewPages            uint64
+	Prefetched          uint64 // pages loaded by Prefetch or read-ahead
+	OptimisticReads     uint64 // ReadOptimistic calls validated without a pin
+	OptimisticFallbacks uint64 // ReadOptimistic calls that took a read guard
+	HandleHits          uint64 // FetchHandle calls that skipped the lookup
+	StaleHandles        uint64 // FetchHandle calls that fell back to FetchPage
+	Replacer            ReplacerStats
+	BgWriter            BgWriterStats
+}
+
+// FrameInfo describes one frame, as returned by Frames.
+type FrameInfo struct {
+	FrameIdx int
+	PageID   util.PageID
+	Resident bool  // false for a frame that never held a page or whose page was deleted
+	PinCount int32 // negative while the frame is being evicted
+	// Usage is the policy's measure of reuse: the usage count for Clock, the
+	// recorded accesses (up to k) for LRU-K, and 1 in t1 or 2 in t2 for ARC.
+	Usage int32
+	Dirty bool
+}
+
+func (s *ReplacerStats) add(other ReplacerStats) {
+	s.Requests += other.Requests
+	s.Recycled += other.Recycled
+	s.Evictions += other.Evictions
+	s.DirtyEvictions += other.DirtyEvictions
+	s.ScanSteps += other.ScanSteps
+	s.Waits += other.Waits
+	s.NoFreeFrame += other.NoFreeFrame
+}
+
+func (s *BgWriterStats) add(other BgWriterStats) {
+	s.Rounds += other.Rounds
+	s.Written += other.Written
+	s.MaxWritten += other.MaxWritten
+	s.Errors += other.Errors
+	s.DirtyEvictions += other.DirtyEvictions
+}
+
+func (s *BufferPoolStats) add(other BufferPoolStats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.LoadWaits += other.LoadWaits
+	s.NewPages += other.NewPages
+	s.Prefetched += other.Prefetched
+	s.OptimisticReads += other.OptimisticReads
+	s.OptimisticFallbacks += other.OptimisticFallbacks
+	s.HandleHits += other.HandleHits
+	s.StaleHandles += other.StaleHandles
+	s.Replacer.add(other.Replacer)
+	s.BgWriter.add(other.BgWriter)
+}
+
+type replacerCounters struct {
+	requests       atomic.Uint64
+	recycled       atomic.Uint64
+	evictions      atomic.Uint64
+	dirtyEvictions atomic.Uint64
+	scanSteps      atomic.Uint64
+	waits          atomic.Uint64
+	noFreeFrame    atomic.Uint64
+}
+
+type poolCounters struct {
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	loadWaits  atomic.Uint64
+	newPages   atomic.Uint64
+	prefetched atomic.Uint64
+
+	optimisticReads     atomic.Uint64
+	optimisticFallbacks atomic.Uint64
+
+	handleHits   atomic.Uint64
+	staleHandles atomic.Uint64
+}
+
+func (rs *ReplacerShared) Stats() ReplacerStats {
+	return ReplacerStats{
+		Requests:       rs.counters.requests.Load(),
+		Recycled:       rs.counters.recycled.Load(),
+		Evictions:      rs.counters.evictions.Load(),
+		DirtyEvictions: rs.counters.dirtyEvictions.Load(),
+		ScanSteps:      rs.counters.scanSteps.Load(),
+		Waits:          rs.counters.waits.Load(),
+		NoFreeFrame:    rs.counters.noFreeFrame.Load(),
+	}
+}
+
+// frameInfos yields every frame in index order. usage reads the policy's measure
+// and runs under muLookup, which is never held while yielding. A resize running
+// meanwhile may end the iteration early or extend it.
+func (rs *ReplacerShared) frameInfos(usage func(frameIdx int) int32) iter.Seq[FrameInfo] {
+	return func(yield func(FrameInfo) bool) {
+		for frameIdx := 0; ; frameIdx++ {
+			rs.muLookup.Lock()
+			// Frames past poolSize are retired by a shrink, or about to be
+			if frameIdx >= rs.poolSize {
+				rs.muLookup.Unlock()
+				return
+			}
+			desc := rs.descs[frameIdx]
+			info := FrameInfo{
+				FrameIdx: frameIdx,
+				PinCount: atomic.LoadInt32(&desc.refCount),
+				Dirty:    desc.dirty.Load(),
+			}
+			if page := desc.page.Load(); page != nil {
+				info.PageID, info.Resident = page.Header.PageID, true
+				info.Usage = usage(frameIdx)
+			}
+			rs.muLookup.Unlock()
+
+			if !yield(info) {
+				return
+			}
+		}
+	}
+}
+
+// Stats returns the pool counters together with the replacer's.
+func (bp *BufferPool) Stats() BufferPoolStats {
+	return BufferPoolStats{
+		Hits:       bp.counters.hits.Load(),
+		Misses:     bp.counters.misses.Load(),
+		LoadWaits:  bp.counters.loadWaits.Load(),
+		NewPages:   bp.counters.newPages.Load(),
+		Prefetched: bp.counters.prefetched.Load(),
+
+		OptimisticReads:     bp.counters.optimisticReads.Load(),
+		OptimisticFallbacks: bp.counters.optimisticFallbacks.Load(),
+		HandleHits:          bp.counters.handleHits.Load(),
+		StaleHandles:        bp.counters.staleHandles.Load(),
+		Replacer:            bp.replacer.Stats(),
+		BgWriter:            bp.BgWriterStats(),
+	}
+}
+
+// Frames iterates over the frames of the pool. Each frame is read on its own,
+// so the sequence is not one consistent snapshot of the whole pool.
+func (bp *BufferPool) Frames() iter.Seq[FrameInfo] {
+	return bp.replacer.Frames()
+}
@@ -0,0 +1,108 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			sp := newSuitePool(t, factory, 2, 4)
+
+			for i := util.PageID(0); i < 2; i++ {
+				_, err := sp.bp.FetchPage(i)
+				assert.NoError(t, err, "fetch page %d", i)
+			}
+			_, err := sp.bp.FetchPage(0)
+			assert.NoError(t, err, "fetch page 0 again")
+
+			// Every frame is pinned, the next miss gives up
+			sp.shared.maxSweeps = 3
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err = sp.bp.FetchPageContext(ctx, 2)
+			assert.ErrorIs(t, err, util.ErrNoFreeFrame, "every frame is pinned")
+
+			assert.NoError(t, sp.bp.Release(0, false))
+			assert.NoError(t, sp.bp.Release(0, false))
+			assert.NoError(t, sp.bp.Release(1, true), "release page 1 dirty")
+			for i := util.PageID(2); i < 4; i++ {
+				_, err := sp.bp.FetchPage(i)
+				assert.NoError(t, err, "fetch page %d", i)
+				assert.NoError(t, sp.bp.Release(i, false))
+			}
+			newPage, err := sp.bp.NewPage()
+			assert.NoError(t, err, "new page")
+			assert.NoError(t, sp.bp.Release(newPage.Header.PageID, false))
+
+			// GetPage of a resident page is a hit, it never loads a missing one
+			_, err = sp.bp.GetPage(newPage.Header.PageID)
+			assert.NoError(t, err, "get resident page")
+			assert.NoError(t, sp.bp.Release(newPage.Header.PageID, false))
+			_, err = sp.bp.GetPage(100)
+			assert.ErrorIs(t, err, util.ErrPageNotFound, "get page never loaded")
+
+			stats := sp.bp.Stats()
+			assert.Equal(t, uint64(2), stats.Hits, "hits, including GetPage")
+			assert.Equal(t, uint64(5), stats.Misses, "misses, including the one that gave up")
+			assert.Equal(t, uint64(1), stats.NewPages, "new pages")
+			assert.Equal(t, uint64(6), stats.Replacer.Requests, "every miss and new page asks the replacer")
+			assert.Equal(t, uint64(3), stats.Replacer.Evictions, "victims that held a page")
+			assert.Equal(t, uint64(1), stats.Replacer.DirtyEvictions, "page 1 written back by eviction")
+			assert.Equal(t, uint64(1), stats.Replacer.Waits, "waited once before giving up")
+			assert.Equal(t, uint64(1), stats.Replacer.NoFreeFrame, "one request gave up")
+			assert.Greater(t, stats.Replacer.ScanSteps, uint64(0), "victim search is counted")
+			assert.Equal(t, stats.Replacer.DirtyEvictions, stats.BgWriter.DirtyEvictions, "bg writer reports the same dirty evictions")
+		})
+	}
+}
+
+func TestFrames(t *testing.T) {
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			sp := newSuitePool(t, factory, 3, 4)
+
+			_, err := sp.bp.FetchPage(0)
+			assert.NoError(t, err, "fetch page 0")
+			_, err = sp.bp.FetchPage(1)
+			assert.NoError(t, err, "fetch page 1")
+			_, err = sp.bp.FetchPage(1)
+			assert.NoError(t, err, "fetch page 1 again")
+			assert.NoError(t, sp.bp.Release(1, true), "release page 1 dirty")
+
+			infos := map[util.PageID]FrameInfo{}
+			empty := 0
+			for info := range sp.bp.Frames() {
+				if !info.Resident {
+					empty++
+					continue
+				}
+				frameIdx, _ := sp.resident(info.PageID)
+				assert.Equal(t, frameIdx, info.FrameIdx, "frame index of page %d", info.PageID)
+				infos[info.PageID] = info
+			}
+
+			assert.Equal(t, 1, empty, "one frame never used")
+			assert.Len(t, infos, 2, "two resident pages")
+			assert.Equal(t, int32(1), infos[0].PinCount, "page 0 pin count")
+			assert.Equal(t, int32(1), infos[1].PinCount, "page 1 pin count")
+			assert.False(t, infos[0].Dirty, "page 0 clean")
+			assert.True(t, infos[1].Dirty, "page 1 dirty")
+			assert.Greater(t, infos[1].Usage, infos[0].Usage, "page 1 was used more")
+
+			seen := 0
+			for range sp.bp.Frames() {
+				seen++
+				break
+			}
+			assert.Equal(t, 1, seen, "iteration stops when the caller breaks")
+			assert.NoError(t, sp.bp.Release(0, false))
+			assert.NoError(t, sp.bp.Release(1, false))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* AccessStrategy keeps a bulk operation from flushing the working set out of
+* the pool, like PostgreSQL's BufferAccessStrategy. Pages the operation reads
+* or creates go into a small private ring of frames, and once the ring is full
+* each miss recycles the frame used one lap ago instead of asking the replacer
+* for a victim. A ring frame that was pinned or became hot since is left to
+* the pool and replaced in the ring by a normal allocation.
+**/
+type AccessStrategyKind int
+
+const (
+	BulkRead  AccessStrategyKind = iota // sequential scan, 256KB ring
+	BulkWrite                           // bulk load through NewPageWith, 16MB ring
+)
+
+type AccessStrategy struct {
+	ring    []int // frame indexes, -1 until the slot is first filled
+	current int
+	mu      sync.Mutex
+}
+
+// NewAccessStrategy sizes the ring for kind, capped at an eighth of the pool
+// so concurrent bulk operations cannot take the whole pool between them.
+func (bp *BufferPool) NewAccessStrategy(kind AccessStrategyKind) *AccessStrategy {
+	ringBytes := 256 * 1024
+	if kind == BulkWrite {
+		ringBytes = 16 * 1024 * 1024
+	}
+
+	return NewAccessStrategyWithSize(min(ringBytes/util.PageSize, bp.rs.Size()/8))
+}
+
+// NewAccessStrategyWithSize builds a strategy with a ring of size frames.
+func NewAccessStrategyWithSize(size int) *AccessStrategy {
+	s := &AccessStrategy{ring: make([]int, max(size, 1)), current: -1}
+	for i := range s.ring {
+		s.ring[i] = -1
+	}
+
+	return s
+}
+
+// RingSize is the number of frames the strategy may hold.
+func (s *AccessStrategy) RingSize() int {
+	return len(s.ring)
+}
+
+// ShardedAccessStrategy is an AccessStrategy for a ShardedBufferPool. A ring
+// holds frames of one replacer, so each shard has its own ring, and a bulk
+// operation recycles frames in every shard its pages hash to.
+type ShardedAccessStrategy struct {
+	shards []*AccessStrategy
+}
+
+// NewAccessStrategy sizes the ring of each shard for kind, capped at an eighth
+// of the shard.
+func (sbp *ShardedBufferPool) NewAccessStrategy(kind AccessStrategyKind) *ShardedAccessStrategy {
+	s := &ShardedAccessStrategy{shards: make([]*AccessStrategy, len(sbp.shards))}
+	for i, bp := range sbp.shards {
+		s.shards[i] = bp.NewAccessStrategy(kind)
+	}
+
+	return s
+}
+
+// RingSize is the number of frames the strategy may hold across all shards.
+func (s *ShardedAccessStrategy) RingSize() int {
+	size := 0
+	for _, shard := range s.shards {
+		size += shard.RingSize()
+	}
+	return size
+}
+
+// of returns the strategy for a shard, nil for a nil strategy.
+func (s *ShardedAccessStrategy) of(shardIdx int) *AccessStrategy {
+	if s == nil {
+		return nil
+	}
+	return s.shards[shardIdx]
+}
+
+// requestFree places pageId in the next ring slot, recycling its frame if the
+// replacer allows, otherwise asking the replacer for a victim.
+func (s *AccessStrategy) requestFree(ctx context.Context, bp *BufferPool, pageId util.PageID, src PageSource) (*page.Page, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current = (s.current + 1) % len(s.ring)
+	if frameIdx := s.ring[s.current]; frameIdx >= 0 {
+		resident, err := bp.replacer.RequestFrame(frameIdx, pageId, src, bp.fm)
+		if err == nil {
+			return resident, nil
+		}
+		if !errors.Is(err, util.ErrNoFreeFrame) {
+			return nil, err
+		}
+	}
+
+	resident, err := bp.replacer.RequestFree(ctx, pageId, src, bp.fm)
+	if err != nil {
+		return nil, err
+	}
+	if frameIdx, exist := bp.rs.frameOf(pageId); exist {
+		s.ring[s.current] = frameIdx
+	}
+
+	return resident, nil
+}
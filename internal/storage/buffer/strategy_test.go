@@ -0,0 +1,118 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessStrategy(t *testing.T) {
+	t.Run("RingSize", func(t *testing.T) {
+		sp := newSuitePool(t, replacerFactories[0], 64, 1)
+		assert.Equal(t, 8, sp.bp.NewAccessStrategy(BulkRead).RingSize(), "ring capped at an eighth of the pool")
+		sp = newSuitePool(t, replacerFactories[0], 8192, 1)
+		assert.Equal(t, 64, sp.bp.NewAccessStrategy(BulkRead).RingSize(), "bulk read ring is 256KB")
+		assert.Equal(t, 1024, sp.bp.NewAccessStrategy(BulkWrite).RingSize(), "bulk write ring is capped by the pool")
+		assert.Equal(t, 1, NewAccessStrategyWithSize(0).RingSize(), "ring holds at least one frame")
+	})
+
+	for _, factory := range replacerFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			t.Run("ScanKeepsWorkingSet", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 8, 40)
+
+				// Hot pages are used twice, the scan below uses the two remaining frames
+				for round := 0; round < 2; round++ {
+					for i := util.PageID(0); i < 6; i++ {
+						_, err := sp.bp.FetchPage(i)
+						assert.NoError(t, err, "fetch hot page %d", i)
+						assert.NoError(t, sp.bp.Release(i, false), "release hot page %d", i)
+					}
+				}
+
+				strategy := NewAccessStrategyWithSize(2)
+				scanFrames := map[int]struct{}{}
+				for i := util.PageID(6); i < 40; i++ {
+					p, err := sp.bp.FetchPageWith(context.Background(), i, strategy)
+					assert.NoError(t, err, "scan page %d", i)
+					assert.Equal(t, i, p.Header.PageID, "correct page ID")
+					frameIdx, _ := sp.resident(i)
+					scanFrames[frameIdx] = struct{}{}
+					assert.NoError(t, sp.bp.Release(i, false), "release scan page %d", i)
+				}
+
+				assert.Len(t, scanFrames, 2, "scan should stay in its ring")
+				for i := util.PageID(0); i < 6; i++ {
+					_, exist := sp.resident(i)
+					assert.True(t, exist, "hot page %d should survive the scan", i)
+				}
+			})
+
+			t.Run("PinnedRingFrameFallsBack", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 4, 4)
+				strategy := NewAccessStrategyWithSize(1)
+
+				_, err := sp.bp.FetchPageWith(context.Background(), 0, strategy)
+				assert.NoError(t, err, "fetch page 0")
+				_, err = sp.bp.FetchPageWith(context.Background(), 1, strategy)
+				assert.NoError(t, err, "fetch page 1 while the ring frame is pinned")
+
+				frame0, exist0 := sp.resident(0)
+				frame1, exist1 := sp.resident(1)
+				assert.True(t, exist0 && exist1, "both pages should be resident")
+				assert.NotEqual(t, frame0, frame1, "pinned ring frame must not be reused")
+				assert.Equal(t, frame1, strategy.ring[0], "ring should follow the new frame")
+				assert.NoError(t, sp.bp.Release(0, false))
+				assert.NoError(t, sp.bp.Release(1, false))
+			})
+
+			t.Run("BulkWriteRecyclesDirtyFrame", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 4, 1)
+				strategy := NewAccessStrategyWithSize(1)
+
+				first, err := sp.bp.NewPageWith(context.Background(), strategy)
+				assert.NoError(t, err, "first new page")
+				copy(first.Data[:], []byte("bulk load"))
+				firstId := first.Header.PageID
+				firstFrame, _ := sp.resident(firstId)
+				assert.NoError(t, sp.bp.Release(firstId, true), "release first page")
+
+				second, err := sp.bp.NewPageWith(context.Background(), strategy)
+				assert.NoError(t, err, "second new page")
+				secondFrame, _ := sp.resident(second.Header.PageID)
+				assert.Equal(t, firstFrame, secondFrame, "ring frame should be recycled")
+				assert.True(t, sp.shared.descs[secondFrame].dirty.Load(), "new page is dirty")
+				assert.NoError(t, sp.bp.Release(second.Header.PageID, false), "release second page")
+
+				_, exist := sp.resident(firstId)
+				assert.False(t, exist, "first page should leave the pool")
+				onDisk, err := sp.fm.ReadPage(firstId)
+				assert.NoError(t, err, "read first page")
+				assert.Equal(t, []byte("bulk load"), onDisk.Data[:9], "recycled dirty frame is written back")
+			})
+
+			t.Run("HotRingFrameFallsBack", func(t *testing.T) {
+				sp := newSuitePool(t, factory, 4, 4)
+				strategy := NewAccessStrategyWithSize(1)
+
+				_, err := sp.bp.FetchPageWith(context.Background(), 0, strategy)
+				assert.NoError(t, err, "fetch page 0")
+				assert.NoError(t, sp.bp.Release(0, false))
+				// Other users keep hitting the page, so it is no longer cold
+				for range 3 {
+					_, err := sp.bp.GetPage(0)
+					assert.NoError(t, err, "hit page 0")
+					assert.NoError(t, sp.bp.Release(0, false))
+				}
+
+				_, err = sp.bp.FetchPageWith(context.Background(), 1, strategy)
+				assert.NoError(t, err, "fetch page 1")
+				_, exist := sp.resident(0)
+				assert.True(t, exist, "hot page should not be recycled")
+				assert.NoError(t, sp.bp.Release(1, false))
+			})
+		})
+	}
+}
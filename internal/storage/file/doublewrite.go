@@ -0,0 +1,201 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* Double write buffer (InnoDB style) protects against torn pages.
+* WritePage only copies 4KB into the mapping and the OS may persist part of it
+* on power loss. With the buffer enabled, every page is first appended to a
+* side file and fsynced, then written in place. The side file is only reset
+* after the mapping has been synced, so any page torn in the data file still
+* has a complete copy in the buffer. A deallocated page is copied as a header
+* with FREED_FLAG, and recovery zeroes it again. Opening a file repairs it from
+* a buffer left by an earlier run even if double write is not enabled again.
+**/
+const DOUBLE_WRITE_SUFFIX = ".dwb"
+
+type DoubleWriteBuffer struct {
+	File  *os.File
+	slots int // max pages held before the data file must be synced
+	next  int // next free slot
+}
+
+// EnableDoubleWrite opens (or creates) the double write file next to the data
+// file, repairs any torn page it has a copy of and routes WritePage through it.
+func (fm *FileManager) EnableDoubleWrite(slots int) error {
+	if slots <= 0 {
+		return util.ErrDoubleWriteSize
+	}
+
+	fm.mmapLock.Lock()
+	defer fm.mmapLock.Unlock()
+
+	if fm.File == nil {
+		return util.ErrFileManagerNil
+	}
+	if fm.dwb != nil {
+		return util.ErrDoubleWriteEnabled
+	}
+
+	f, err := os.OpenFile(fm.File.Name()+DOUBLE_WRITE_SUFFIX, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return fmt.Errorf("open double write file: %w", err)
+	}
+
+	dwb := &DoubleWriteBuffer{File: f, slots: slots}
+	if err := fm.recoverTornPages(dwb); err != nil {
+		f.Close()
+		return fmt.Errorf("recover torn pages: %w", err)
+	}
+
+	fm.dwb = dwb
+	return nil
+}
+
+// recoverOnOpen repairs torn pages from the double write file of an earlier
+// run, if there is one. Only called by NewFileManager.
+func (fm *FileManager) recoverOnOpen() (err error) {
+	f, err := os.OpenFile(fm.File.Name()+DOUBLE_WRITE_SUFFIX, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open double write file: %w", err)
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+
+	fm.mmapLock.Lock()
+	defer fm.mmapLock.Unlock()
+	return fm.recoverTornPages(&DoubleWriteBuffer{File: f})
+}
+
+// recoverTornPages restores every page in the data file that fails its
+// checksum from the latest intact copy in the double write file.
+// Caller must hold mmapLock for writing.
+func (fm *FileManager) recoverTornPages(dwb *DoubleWriteBuffer) error {
+	if _, err := dwb.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Later slots hold newer copies of the same page, nil if it was freed
+	copies := make(map[util.PageID][]byte)
+	for {
+		slot := make([]byte, util.PageSize)
+		if _, err := io.ReadFull(dwb.File, slot); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+
+		// A torn slot means the crash happened before the in-place write
+		p, err := page.Deserialize(slot)
+		if err != nil {
+			continue
+		}
+		if p.Header.Flags&page.FREED_FLAG != 0 {
+			slot = nil
+		}
+		copies[p.Header.PageID] = slot
+	}
+
+	repaired := 0
+	for pageId, slot := range copies {
+		offset := int64(pageId) * int64(util.PageSize)
+		freed := slot == nil
+		if offset+int64(util.PageSize) <= fm.Size {
+			current := fm.Data[offset : offset+int64(util.PageSize)]
+			if _, err := page.Deserialize(current); err == nil {
+				continue
+			}
+			if freed && isZeroPage(current) {
+				continue
+			}
+		} else if freed {
+			continue // Past the end reads as zeroed already
+		}
+
+		if freed {
+			slot = make([]byte, util.PageSize)
+		}
+		if err := fm.writeLocked(pageId, slot); err != nil {
+			return fmt.Errorf("restore page %d: %w", pageId, err)
+		}
+		repaired++
+	}
+
+	if repaired > 0 {
+		if err := fm.syncLocked(); err != nil {
+			return err
+		}
+	}
+	return dwb.reset()
+}
+
+// doubleWriteLocked makes a copy of a serialized page durable before it is
+// written in place, otherwise a torn page has nothing to recover from.
+// Caller must hold mmapLock for writing.
+func (fm *FileManager) doubleWriteLocked(data []byte) error {
+	if fm.dwb.full() {
+		if err := fm.syncLocked(); err != nil {
+			return fmt.Errorf("sync before double write reset: %w", err)
+		}
+		if err := fm.dwb.reset(); err != nil {
+			return fmt.Errorf("reset double write buffer: %w", err)
+		}
+	}
+
+	return fm.dwb.append(data)
+}
+
+func (dwb *DoubleWriteBuffer) full() bool {
+	return dwb.next >= dwb.slots
+}
+
+// append writes a serialized page into the next slot and syncs it.
+func (dwb *DoubleWriteBuffer) append(data []byte) error {
+	offset := int64(dwb.next) * int64(util.PageSize)
+	if _, err := dwb.File.WriteAt(data, offset); err != nil {
+		return err
+	}
+	if err := dwb.File.Sync(); err != nil {
+		return err
+	}
+
+	dwb.next++
+	return nil
+}
+
+// reset drops every slot. Only safe once the data file has been synced.
+func (dwb *DoubleWriteBuffer) reset() error {
+	if err := dwb.File.Truncate(0); err != nil {
+		return err
+	}
+	if err := dwb.File.Sync(); err != nil {
+		return err
+	}
+
+	dwb.next = 0
+	return nil
+}
+
+// close releases the double write file, dropping its slots if the data file
+// is known to be durable.
+func (dwb *DoubleWriteBuffer) close(durable bool) error {
+	var err error
+	if durable {
+		err = dwb.reset()
+	}
+	if e := dwb.File.Close(); e != nil {
+		err = errors.Join(err, e)
+	}
+	return err
+}
@@ -21,7 +21,10 @@ type FileManager struct {
 	Size    int64
 	Mapping syscall.Handle
 
-	mmapLock sync.RWMutex
+	dwb        *DoubleWriteBuffer // nil unless EnableDoubleWrite was called
+	nextPageId util.PageID        // first page id never handed out or written
+	freePages  map[util.PageID]struct{}
+	mmapLock   sync.RWMutex
 }
 
 func NewFileManager(path string, initialPages int) (*FileManager, error) {
@@ -35,45 +38,150 @@ func NewFileManager(path string, initialPages int) (*FileManager, error) {
 	if err != nil {
 		return nil, fmt.Errorf("open file: %w", err)
 	}
+	// mmap truncates to the size, an existing file that grew must keep its pages
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+	pageSize := int64(util.PageSize)
+	initialSize = max(initialSize, (info.Size()+pageSize-1)/pageSize*pageSize)
 
-	fm := &FileManager{File: f}
+	fm := &FileManager{File: f, freePages: make(map[util.PageID]struct{})}
 
 	if err := mmap(fm, initialSize); err != nil {
 		f.Close()
 		return nil, fmt.Errorf("map file fail: %w", err)
 	}
+	// Before scanPages, so a repaired page counts as allocated or free
+	if err := fm.recoverOnOpen(); err != nil {
+		munmap(fm)
+		f.Close()
+		return nil, fmt.Errorf("recover torn pages: %w", err)
+	}
+	fm.scanPages()
 
 	return fm, nil
 }
 
+// scanPages places allocation one past the highest page in the mapping that
+// holds a valid page, so a page with data is never handed out again. Zeroed
+// pages below it were deallocated and go back on the free list.
+func (fm *FileManager) scanPages() {
+	fm.nextPageId = 0
+	for id := fm.Size/int64(util.PageSize) - 1; id >= 0; id-- {
+		offset := id * int64(util.PageSize)
+		p, err := page.Deserialize(fm.Data[offset : offset+int64(util.PageSize)])
+		if err == nil && p.Header.PageID == util.PageID(id) {
+			fm.nextPageId = util.PageID(id + 1)
+			break
+		}
+	}
+
+	for id := util.PageID(0); id < fm.nextPageId; id++ {
+		offset := int64(id) * int64(util.PageSize)
+		if isZeroPage(fm.Data[offset : offset+int64(util.PageSize)]) {
+			fm.freePages[id] = struct{}{}
+		}
+	}
+}
+
+func isZeroPage(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// AllocatePage reserves a page id, reusing a deallocated page before growing
+// the file. Nothing is written to the file until the page itself is written.
+func (fm *FileManager) AllocatePage() (util.PageID, error) {
+	fm.mmapLock.Lock()
+	defer fm.mmapLock.Unlock()
+
+	if fm.File == nil {
+		return 0, util.ErrFileManagerNil
+	}
+
+	for pageId := range fm.freePages {
+		delete(fm.freePages, pageId)
+		return pageId, nil
+	}
+
+	pageId := fm.nextPageId
+	if (int64(pageId)+1)*int64(util.PageSize) > util.MAX_MAP_SIZE {
+		return 0, util.ErrMaxMapSizeExceeded
+	}
+	fm.nextPageId++
+
+	return pageId, nil
+}
+
+// DeallocatePage zeroes a page on disk and puts its id on the free list.
+func (fm *FileManager) DeallocatePage(pageId util.PageID) error {
+	fm.mmapLock.Lock()
+	defer fm.mmapLock.Unlock()
+
+	if fm.Data == nil {
+		return util.ErrFileDataNil
+	}
+	if pageId >= fm.nextPageId {
+		return util.ErrInvalidPageId
+	}
+	if _, free := fm.freePages[pageId]; free {
+		return util.ErrPageAlreadyFree
+	}
+
+	offset := int64(pageId) * int64(util.PageSize)
+	if offset+int64(util.PageSize) <= fm.Size {
+		// Zeroing can tear like any write. Without a copy, recovery would
+		// bring back an older copy of the page from the buffer
+		if fm.dwb != nil {
+			freed := page.Page{Header: page.PageHeader{PageID: pageId, Flags: page.FREED_FLAG}}
+			if err := fm.doubleWriteLocked(freed.Serialize()); err != nil {
+				return fmt.Errorf("[DeallocatePage] double write page %d: %w", pageId, err)
+			}
+		}
+		clear(fm.Data[offset : offset+int64(util.PageSize)])
+	}
+	fm.freePages[pageId] = struct{}{}
+
+	return nil
+}
+
 // When read from disk -> Deseialize the data to page.Page
 /* READ FILE */
 func (fm *FileManager) ReadPage(pageId util.PageID) (*page.Page, error) {
+	var p page.Page
+	if err := fm.ReadPageInto(pageId, &p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// ReadPageInto reads the page into dst, straight from the mapping and without
+// allocating. dst is left untouched on error, e.g. a checksum mismatch.
+func (fm *FileManager) ReadPageInto(pageId util.PageID, dst *page.Page) error {
 	fm.mmapLock.RLock()
+	defer fm.mmapLock.RUnlock()
 
 	if fm.Data == nil {
-		fm.mmapLock.RUnlock()
-		return nil, util.ErrFileDataNil
+		return util.ErrFileDataNil
 	}
 
 	offset := int64(pageId) * int64(util.PageSize)
 	if offset+util.PageSize > fm.Size {
-		fm.mmapLock.RUnlock()
-		return nil, util.ErrPageOutOfBounds
+		return util.ErrPageOutOfBounds
 	}
 
-	// Make a copy of the data to avoid holding the lock during deserialization
-	pageData := make([]byte, util.PageSize)
-	copy(pageData, fm.Data[offset:offset+int64(util.PageSize)])
-
-	fm.mmapLock.RUnlock()
-
-	page, err := page.Deserialize(pageData)
-	if err != nil {
-		return nil, fmt.Errorf("deserialize page %d: %w", pageId, err)
+	if err := page.DeserializeInto(fm.Data[offset:offset+int64(util.PageSize)], dst); err != nil {
+		return fmt.Errorf("deserialize page %d: %w", pageId, err)
 	}
 
-	return page, nil
+	return nil
 }
 
 // When write to disk -> Serialize the data to []byte and store them in disk by offset
@@ -85,7 +193,19 @@ func (fm *FileManager) WritePage(p *page.Page) error {
 	fm.mmapLock.Lock()
 	defer fm.mmapLock.Unlock()
 
-	offset := int64(p.Header.PageID) * int64(util.PageSize)
+	if fm.dwb != nil {
+		if err := fm.doubleWriteLocked(serializedData); err != nil {
+			return fmt.Errorf("[WritePage] double write page %d: %w", p.Header.PageID, err)
+		}
+	}
+
+	return fm.writeLocked(p.Header.PageID, serializedData)
+}
+
+// writeLocked copies a serialized page into the mapping, growing it if needed.
+// Caller must hold mmapLock for writing.
+func (fm *FileManager) writeLocked(pageId util.PageID, data []byte) error {
+	offset := int64(pageId) * int64(util.PageSize)
 	if offset+int64(util.PageSize) > fm.Size {
 		newSize := max(fm.Size*2, offset+int64(util.PageSize))
 		if newSize > util.MAX_MAP_SIZE {
@@ -101,7 +221,62 @@ func (fm *FileManager) WritePage(p *page.Page) error {
 		}
 	}
 
-	copy(fm.Data[offset:], serializedData)
+	copy(fm.Data[offset:], data)
+	if pageId >= fm.nextPageId {
+		fm.nextPageId = pageId + 1
+	}
+	return nil
+}
+
+// WillNeed hints the OS that the pages will be read soon, so it can start
+// reading them into the mapping. Consecutive ids are advised as one range and
+// ids past the end of the file are ignored. It never blocks on the reads.
+func (fm *FileManager) WillNeed(pageIds []util.PageID) error {
+	fm.mmapLock.RLock()
+	defer fm.mmapLock.RUnlock()
+
+	if fm.Data == nil {
+		return util.ErrFileDataNil
+	}
+
+	numPages := util.PageID(fm.Size / util.PageSize)
+	for i := 0; i < len(pageIds); {
+		start := pageIds[i]
+		end := start + 1
+		for i++; i < len(pageIds) && pageIds[i] == end; i++ {
+			end++
+		}
+		end = min(end, numPages)
+		if start >= end {
+			continue
+		}
+
+		if err := madviseWillNeed(fm.Data[start*util.PageSize : end*util.PageSize]); err != nil {
+			return fmt.Errorf("advise pages %d-%d: %w", start, end-1, err)
+		}
+	}
+
+	return nil
+}
+
+// Sync flushes the mapping and the file to stable storage.
+func (fm *FileManager) Sync() error {
+	fm.mmapLock.Lock()
+	defer fm.mmapLock.Unlock()
+
+	return fm.syncLocked()
+}
+
+func (fm *FileManager) syncLocked() error {
+	if fm.File == nil {
+		return util.ErrFileManagerNil
+	}
+	if err := msync(fm); err != nil {
+		return fmt.Errorf("flush mapping: %w", err)
+	}
+	if err := fm.File.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
 	return nil
 }
 
@@ -116,9 +291,15 @@ func (fm *FileManager) Close() error {
 	fm.mmapLock.Lock()
 	defer fm.mmapLock.Unlock()
 
+	// Every handle is closed whatever fails, the errors are joined
 	var err error
-	if err := munmap(fm); err != nil {
-		return fmt.Errorf("[close] unmap file fail: %w", err)
+	if fm.dwb != nil {
+		if e := msync(fm); e != nil {
+			err = fmt.Errorf("[close] flush mapping fail: %w", e)
+		}
+	}
+	if e := munmap(fm); e != nil {
+		err = errors.Join(err, fmt.Errorf("[close] unmap file fail: %w", e))
 	}
 
 	if fm.File != nil {
@@ -130,5 +311,13 @@ func (fm *FileManager) Close() error {
 		}
 		fm.File = nil
 	}
+
+	if fm.dwb != nil {
+		// Every page is on disk now, so the double write copies are stale.
+		if e := fm.dwb.close(err == nil); e != nil {
+			err = errors.Join(err, fmt.Errorf("close double write buffer: %w", e))
+		}
+		fm.dwb = nil
+	}
 	return err
 }
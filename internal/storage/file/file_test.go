@@ -2,8 +2,13 @@ package file_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bietkhonhungvandi212/array-db/internal/storage/file"
 	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
@@ -198,3 +203,367 @@ func TestFileManagerReadWrite(t *testing.T) {
 		})
 	}
 }
+
+func TestReadPageInto(t *testing.T) {
+	path, cleanup := util.CreateTempFile(t)
+	defer cleanup()
+
+	fm, err := file.NewFileManager(path, 2)
+	assert.NoError(t, err, "NewFileManager failed")
+	defer fm.Close()
+	assert.NoError(t, fm.WritePage(page.CreateTestPage(0, []byte("page 0"))), "WritePage failed")
+
+	var dst page.Page
+	assert.NoError(t, fm.ReadPageInto(0, &dst), "ReadPageInto failed")
+	assert.Equal(t, util.PageID(0), dst.Header.PageID, "page id")
+	assert.Equal(t, []byte("page 0"), dst.Data[:6], "page data")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		fm.ReadPageInto(0, &dst)
+	})
+	assert.Equal(t, float64(0), allocs, "ReadPageInto should not allocate")
+
+	// A failed read leaves dst as it was
+	before := dst
+	assert.ErrorIs(t, fm.ReadPageInto(1, &dst), util.ErrChecksumMismatch, "page 1 was never written")
+	assert.ErrorIs(t, fm.ReadPageInto(2, &dst), util.ErrPageOutOfBounds, "page past the end")
+	assert.Equal(t, before, dst, "dst untouched")
+}
+
+func TestDoubleWriteBuffer(t *testing.T) {
+	t.Run("Invalid size", func(t *testing.T) {
+		path, cleanup := util.CreateTempFile(t)
+		defer cleanup()
+		fm, err := file.NewFileManager(path, 1)
+		assert.NoError(t, err, "NewFileManager failed")
+		defer fm.Close()
+
+		assert.ErrorIs(t, fm.EnableDoubleWrite(0), util.ErrDoubleWriteSize)
+		assert.NoError(t, fm.EnableDoubleWrite(4), "EnableDoubleWrite failed")
+		assert.ErrorIs(t, fm.EnableDoubleWrite(4), util.ErrDoubleWriteEnabled)
+	})
+
+	t.Run("Reset when full", func(t *testing.T) {
+		path, cleanup := util.CreateTempFile(t)
+		defer cleanup()
+		fm, err := file.NewFileManager(path, 1)
+		assert.NoError(t, err, "NewFileManager failed")
+		defer fm.Close()
+		assert.NoError(t, fm.EnableDoubleWrite(2), "EnableDoubleWrite failed")
+
+		for i := util.PageID(0); i < 5; i++ {
+			assert.NoError(t, fm.WritePage(page.CreateTestPage(i, []byte("double write"))), "WritePage %d", i)
+		}
+
+		info, err := os.Stat(path + file.DOUBLE_WRITE_SUFFIX)
+		assert.NoError(t, err, "Expected double write file to exist")
+		assert.LessOrEqual(t, info.Size(), int64(2*util.PageSize), "double write file should not exceed its slots")
+	})
+
+	t.Run("Recover torn page", func(t *testing.T) {
+		path, cleanup := util.CreateTempFile(t)
+		defer cleanup()
+		fm, err := file.NewFileManager(path, 3)
+		assert.NoError(t, err, "NewFileManager failed")
+		defer fm.Close()
+		assert.NoError(t, fm.EnableDoubleWrite(8), "EnableDoubleWrite failed")
+
+		data := generateBinaryData(util.PageSize - page.HEADER_SIZE)
+		for i := util.PageID(0); i < 3; i++ {
+			assert.NoError(t, fm.WritePage(page.CreateTestPage(i, data)), "WritePage %d", i)
+		}
+
+		// Build the on-disk image of a crash that persisted only half of page 1
+		image := make([]byte, fm.Size)
+		copy(image, fm.Data)
+		torn := image[util.PageSize : 2*util.PageSize]
+		for i := util.PageSize / 2; i < util.PageSize; i++ {
+			torn[i] = 0
+		}
+		dwbData, err := os.ReadFile(path + file.DOUBLE_WRITE_SUFFIX)
+		assert.NoError(t, err, "read double write file")
+
+		crashPath := path + ".crash"
+		assert.NoError(t, os.WriteFile(crashPath, image, 0o666))
+		assert.NoError(t, os.WriteFile(crashPath+file.DOUBLE_WRITE_SUFFIX, dwbData, 0o666))
+
+		// Opening repairs the page without enabling double write again
+		recovered, err := file.NewFileManager(crashPath, 3)
+		assert.NoError(t, err, "NewFileManager on crash image failed")
+		defer recovered.Close()
+		for i := util.PageID(0); i < 3; i++ {
+			p, err := recovered.ReadPage(i)
+			assert.NoError(t, err, "ReadPage %d after recovery", i)
+			assert.True(t, bytes.Equal(data, p.Data[:]), "Data mismatch at page %d", i)
+		}
+		assert.NoError(t, recovered.EnableDoubleWrite(8), "EnableDoubleWrite after recovery")
+	})
+
+	t.Run("Recover torn deallocation", func(t *testing.T) {
+		path, cleanup := util.CreateTempFile(t)
+		defer cleanup()
+		fm, err := file.NewFileManager(path, 3)
+		assert.NoError(t, err, "NewFileManager failed")
+		defer fm.Close()
+		assert.NoError(t, fm.EnableDoubleWrite(8), "EnableDoubleWrite failed")
+
+		data := generateBinaryData(util.PageSize - page.HEADER_SIZE)
+		for i := util.PageID(0); i < 3; i++ {
+			assert.NoError(t, fm.WritePage(page.CreateTestPage(i, data)), "WritePage %d", i)
+		}
+		written := make([]byte, util.PageSize)
+		copy(written, fm.Data[util.PageSize:2*util.PageSize])
+		assert.NoError(t, fm.DeallocatePage(1), "DeallocatePage failed")
+
+		// A crash that zeroed only the first half of page 1
+		image := make([]byte, fm.Size)
+		copy(image, fm.Data)
+		copy(image[util.PageSize+util.PageSize/2:2*util.PageSize], written[util.PageSize/2:])
+		dwbData, err := os.ReadFile(path + file.DOUBLE_WRITE_SUFFIX)
+		assert.NoError(t, err, "read double write file")
+
+		crashPath := path + ".crash"
+		assert.NoError(t, os.WriteFile(crashPath, image, 0o666))
+		assert.NoError(t, os.WriteFile(crashPath+file.DOUBLE_WRITE_SUFFIX, dwbData, 0o666))
+
+		recovered, err := file.NewFileManager(crashPath, 3)
+		assert.NoError(t, err, "NewFileManager on crash image failed")
+		defer recovered.Close()
+		assert.Equal(t, make([]byte, util.PageSize), recovered.Data[util.PageSize:2*util.PageSize], "freed page zeroed, not restored")
+		pageId, err := recovered.AllocatePage()
+		assert.NoError(t, err, "AllocatePage failed")
+		assert.Equal(t, util.PageID(1), pageId, "freed page is free again")
+		for _, i := range []util.PageID{0, 2} {
+			p, err := recovered.ReadPage(i)
+			assert.NoError(t, err, "ReadPage %d after recovery", i)
+			assert.True(t, bytes.Equal(data, p.Data[:]), "Data mismatch at page %d", i)
+		}
+	})
+}
+
+func TestAllocatePage(t *testing.T) {
+	path, cleanup := util.CreateTempFile(t)
+	defer cleanup()
+
+	fm, err := file.NewFileManager(path, 4)
+	assert.NoError(t, err, "NewFileManager failed")
+
+	for want := util.PageID(0); want < 2; want++ {
+		pageId, err := fm.AllocatePage()
+		assert.NoError(t, err, "AllocatePage failed")
+		assert.Equal(t, want, pageId, "fresh file should allocate sequentially")
+	}
+
+	// Writing past the allocated range moves allocation past it
+	assert.NoError(t, fm.WritePage(page.CreateTestPage(5, []byte("page 5"))), "WritePage failed")
+	pageId, err := fm.AllocatePage()
+	assert.NoError(t, err, "AllocatePage failed")
+	assert.Equal(t, util.PageID(6), pageId, "allocation should skip written pages")
+	assert.NoError(t, fm.Close(), "Close failed")
+
+	// Reopening reuses the zeroed pages below page 5, then resumes after it
+	fm, err = file.NewFileManager(path, 8)
+	assert.NoError(t, err, "reopen FileManager failed")
+	defer fm.Close()
+	var reused []util.PageID
+	for range 5 {
+		pageId, err = fm.AllocatePage()
+		assert.NoError(t, err, "AllocatePage failed")
+		reused = append(reused, pageId)
+	}
+	assert.ElementsMatch(t, []util.PageID{0, 1, 2, 3, 4}, reused, "zeroed pages should be reused")
+	pageId, err = fm.AllocatePage()
+	assert.NoError(t, err, "AllocatePage failed")
+	assert.Equal(t, util.PageID(6), pageId, "allocation should resume after page 5")
+}
+
+func TestDeallocatePage(t *testing.T) {
+	path, cleanup := util.CreateTempFile(t)
+	defer cleanup()
+
+	fm, err := file.NewFileManager(path, 4)
+	assert.NoError(t, err, "NewFileManager failed")
+
+	for i := util.PageID(0); i < 3; i++ {
+		assert.NoError(t, fm.WritePage(page.CreateTestPage(i, []byte("in use"))), "WritePage %d", i)
+	}
+
+	assert.ErrorIs(t, fm.DeallocatePage(3), util.ErrInvalidPageId, "page 3 was never allocated")
+	assert.NoError(t, fm.DeallocatePage(1), "DeallocatePage failed")
+	assert.ErrorIs(t, fm.DeallocatePage(1), util.ErrPageAlreadyFree, "double free")
+
+	_, err = fm.ReadPage(1)
+	assert.ErrorIs(t, err, util.ErrChecksumMismatch, "deallocated page should be zeroed")
+	assert.NoError(t, fm.Close(), "Close failed")
+
+	// The free list survives reopening because freed pages are zeroed
+	fm, err = file.NewFileManager(path, 4)
+	assert.NoError(t, err, "reopen FileManager failed")
+	defer fm.Close()
+
+	pageId, err := fm.AllocatePage()
+	assert.NoError(t, err, "AllocatePage failed")
+	assert.Equal(t, util.PageID(1), pageId, "freed page should be reused first")
+	pageId, err = fm.AllocatePage()
+	assert.NoError(t, err, "AllocatePage failed")
+	assert.Equal(t, util.PageID(3), pageId, "allocation should grow once the free list is empty")
+}
+
+func TestWillNeed(t *testing.T) {
+	path, cleanup := util.CreateTempFile(t)
+	defer cleanup()
+
+	fm, err := file.NewFileManager(path, 4)
+	assert.NoError(t, err, "NewFileManager failed")
+
+	assert.NoError(t, fm.WillNeed([]util.PageID{0, 1, 2, 3}), "one range")
+	assert.NoError(t, fm.WillNeed([]util.PageID{3, 0, 2}), "unordered ids")
+	assert.NoError(t, fm.WillNeed([]util.PageID{2, 3, 4, 9}), "ids past the end are ignored")
+	assert.NoError(t, fm.WillNeed(nil), "no ids")
+
+	assert.NoError(t, fm.Close(), "Close failed")
+	assert.ErrorIs(t, fm.WillNeed([]util.PageID{0}), util.ErrFileDataNil, "closed file")
+}
+
+func fileSetOptions(maxOpen int) util.Options {
+	opts := util.DefaultOptions()
+	opts.MaxOpenFiles = maxOpen
+	return opts
+}
+
+func TestFileSet(t *testing.T) {
+	_, err := file.NewFileSet(fileSetOptions(0))
+	assert.ErrorIs(t, err, util.ErrInvalidMaxOpenFiles, "no file may be open")
+
+	dir := t.TempDir()
+	fs, err := file.NewFileSet(fileSetOptions(2))
+	assert.NoError(t, err, "NewFileSet failed")
+	for fileId := util.FileID(0); fileId < 3; fileId++ {
+		path := filepath.Join(dir, fmt.Sprintf("file-%d.dat", fileId))
+		assert.NoError(t, fs.Register(fileId, path, 4), "Register file %d", fileId)
+	}
+	assert.ErrorIs(t, fs.Register(1, filepath.Join(dir, "other.dat"), 4), util.ErrFileExists, "file id taken")
+	assert.ErrorIs(t, fs.Register(util.MAX_FILE_ID+1, filepath.Join(dir, "other.dat"), 4), util.ErrInvalidFileId, "file id too large")
+	assert.Equal(t, 0, fs.OpenFiles(), "files open lazily")
+
+	// Each file numbers its own pages, the file id goes in the page id
+	var ids []util.PageID
+	for fileId := util.FileID(0); fileId < 3; fileId++ {
+		pageId, err := fs.AllocatePageIn(fileId)
+		assert.NoError(t, err, "AllocatePageIn file %d", fileId)
+		assert.Equal(t, util.NewPageID(fileId, 0), pageId, "first page of file %d", fileId)
+		assert.Equal(t, fileId, pageId.FileID(), "file of the page")
+		assert.LessOrEqual(t, fs.OpenFiles(), 2, "open files capped")
+
+		data := []byte(fmt.Sprintf("file %d", fileId))
+		assert.NoError(t, fs.WritePage(page.CreateTestPage(pageId, data)), "WritePage %d", pageId)
+		ids = append(ids, pageId)
+	}
+	_, err = fs.AllocatePageIn(3)
+	assert.ErrorIs(t, err, util.ErrUnknownFile, "unregistered file")
+
+	// Reading file 0 again reopens it in place of the least recently used
+	for i, pageId := range ids {
+		p, err := fs.ReadPage(pageId)
+		assert.NoError(t, err, "ReadPage %d", pageId)
+		assert.Equal(t, pageId, p.Header.PageID, "global page id")
+		assert.Equal(t, []byte(fmt.Sprintf("file %d", i)), p.Data[:6], "page of file %d", i)
+		assert.Equal(t, 2, fs.OpenFiles(), "open files capped")
+	}
+	assert.NoError(t, fs.WillNeed(ids), "pages of several files")
+	assert.NoError(t, fs.Sync(), "Sync failed")
+
+	// Pages allocated before a file was closed are not handed out again
+	pageId, err := fs.AllocatePageIn(1)
+	assert.NoError(t, err, "AllocatePageIn failed")
+	assert.Equal(t, util.NewPageID(1, 1), pageId, "allocation survives closing the file")
+	pageId, err = fs.AllocatePage()
+	assert.NoError(t, err, "AllocatePage failed")
+	assert.Equal(t, util.NewPageID(0, 1), pageId, "AllocatePage uses file 0")
+	assert.NoError(t, fs.DeallocatePage(pageId), "DeallocatePage failed")
+
+	assert.NoError(t, fs.Close(), "Close failed")
+	assert.Equal(t, 0, fs.OpenFiles(), "every file closed")
+	_, err = fs.ReadPage(ids[0])
+	assert.ErrorIs(t, err, util.ErrFileSetClosed, "closed set")
+
+	// A file of the set is an ordinary file numbered from 0
+	fm, err := file.NewFileManager(filepath.Join(dir, "file-2.dat"), 4)
+	assert.NoError(t, err, "open file 2 alone")
+	defer fm.Close()
+	p, err := fm.ReadPage(0)
+	assert.NoError(t, err, "ReadPage failed")
+	assert.Equal(t, util.PageID(0), p.Header.PageID, "page number on disk")
+	assert.Equal(t, []byte("file 2"), p.Data[:6], "page data")
+}
+
+func TestFileSetCloseWhileInUse(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := file.NewFileSet(fileSetOptions(1))
+	assert.NoError(t, err, "NewFileSet failed")
+	var ids []util.PageID
+	for fileId := util.FileID(0); fileId < 2; fileId++ {
+		assert.NoError(t, fs.Register(fileId, filepath.Join(dir, fmt.Sprintf("file-%d.dat", fileId)), 4), "Register file %d", fileId)
+		pageId, err := fs.AllocatePageIn(fileId)
+		assert.NoError(t, err, "AllocatePageIn file %d", fileId)
+		ids = append(ids, pageId)
+	}
+
+	// Reads and writes in flight finish on an open file or see the set closed
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			pageId := ids[i%len(ids)]
+			for {
+				var err error
+				if i%2 == 0 {
+					_, err = fs.ReadPage(pageId)
+				} else {
+					err = fs.WritePage(page.CreateTestPage(pageId, []byte("in use")))
+				}
+				if errors.Is(err, util.ErrFileSetClosed) {
+					return
+				}
+				assert.NoError(t, err, "use of page %d", pageId)
+			}
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, fs.Close(), "Close failed")
+	wg.Wait()
+	assert.Equal(t, 0, fs.OpenFiles(), "every file closed")
+}
+
+func TestFileSetReopenKeepsGrownFile(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := file.NewFileSet(fileSetOptions(1))
+	assert.NoError(t, err, "NewFileSet failed")
+	defer fs.Close()
+	for fileId := util.FileID(1); fileId < 3; fileId++ {
+		assert.NoError(t, fs.Register(fileId, filepath.Join(dir, fmt.Sprintf("file-%d.dat", fileId)), 1), "Register file %d", fileId)
+	}
+
+	// File 1 grows past its initial page
+	var ids []util.PageID
+	for i := range 4 {
+		pageId, err := fs.AllocatePageIn(1)
+		assert.NoError(t, err, "AllocatePageIn %d", i)
+		assert.NoError(t, fs.WritePage(page.CreateTestPage(pageId, []byte(fmt.Sprintf("grown %d", i)))), "WritePage %d", pageId)
+		ids = append(ids, pageId)
+	}
+
+	// Using file 2 closes file 1, the next use reopens it
+	_, err = fs.AllocatePageIn(2)
+	assert.NoError(t, err, "AllocatePageIn file 2")
+	assert.Equal(t, 1, fs.OpenFiles(), "file 1 closed")
+	for i, pageId := range ids {
+		p, err := fs.ReadPage(pageId)
+		assert.NoError(t, err, "ReadPage %d after reopen", pageId)
+		if err == nil {
+			assert.Equal(t, []byte(fmt.Sprintf("grown %d", i)), p.Data[:7], "page %d kept", pageId)
+		}
+	}
+	pageId, err := fs.AllocatePageIn(1)
+	assert.NoError(t, err, "AllocatePageIn after reopen")
+	assert.Equal(t, util.NewPageID(1, 4), pageId, "allocation resumes after the grown pages")
+}
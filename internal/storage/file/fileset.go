@@ -0,0 +1,317 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bietkhonhungvandi212/array-db/internal/storage/page"
+	util "github.com/bietkhonhungvandi212/array-db/internal/utils"
+)
+
+/**
+* FileSet serves the pages of several files, e.g. one per table and index, to
+* one buffer pool. A page id carries its FileID in the top bits, and each file
+* stores its pages under their page number, so a file can be used on its own
+* as file 0 too. Files are opened on first use and at most maxOpen of them stay
+* open: opening one more closes the least recently used file nobody is
+* reading or writing. While every open file is in use the set goes over the
+* limit, and closes the extra files once they are idle.
+**/
+type FileSet struct {
+	mu      sync.RWMutex // Guards files and opening or closing any of them
+	files   map[util.FileID]*setFile
+	maxOpen int
+	open    atomic.Int32
+	clock   atomic.Uint64  // logical time of the last use of a file
+	inUse   sync.WaitGroup // acquired uses not released yet, Close waits for them
+	closed  bool
+}
+
+type setFile struct {
+	path         string
+	initialPages int
+	fm           *FileManager // nil while closed
+	refs         atomic.Int32 // calls using fm, it is only closed at 0
+	lastUsed     atomic.Uint64
+}
+
+// NewFileSet builds an empty file set keeping at most opts.MaxOpenFiles files
+// open.
+func NewFileSet(opts util.Options) (*FileSet, error) {
+	if opts.MaxOpenFiles <= 0 {
+		return nil, util.ErrInvalidMaxOpenFiles
+	}
+
+	return &FileSet{files: make(map[util.FileID]*setFile), maxOpen: opts.MaxOpenFiles}, nil
+}
+
+// Register adds a file under fileId. It is opened, and created with
+// initialPages if missing, on first use. A file must keep its FileID, the
+// page ids handed out for it contain it.
+func (fs *FileSet) Register(fileId util.FileID, path string, initialPages int) error {
+	if fileId > util.MAX_FILE_ID {
+		return util.ErrInvalidFileId
+	}
+	if initialPages <= 0 {
+		return util.ErrInvalidInitialPages
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return util.ErrFileSetClosed
+	}
+	if _, exist := fs.files[fileId]; exist {
+		return util.ErrFileExists
+	}
+	fs.files[fileId] = &setFile{path: path, initialPages: initialPages}
+
+	return nil
+}
+
+// OpenFiles is the number of files currently open.
+func (fs *FileSet) OpenFiles() int {
+	return int(fs.open.Load())
+}
+
+// acquire returns the file open, counting a use until release.
+func (fs *FileSet) acquire(fileId util.FileID) (*setFile, error) {
+	fs.mu.RLock()
+	f, exist := fs.files[fileId]
+	if exist && f.fm != nil && !fs.closed {
+		fs.inUse.Add(1)
+		f.refs.Add(1)
+		f.lastUsed.Store(fs.clock.Add(1))
+		fs.mu.RUnlock()
+		return f, nil
+	}
+	closed := fs.closed
+	fs.mu.RUnlock()
+	if closed {
+		return nil, util.ErrFileSetClosed
+	}
+	if !exist {
+		return nil, fmt.Errorf("%w: file %d", util.ErrUnknownFile, fileId)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return nil, util.ErrFileSetClosed
+	}
+	if f.fm == nil {
+		if err := fs.closeIdle(fs.maxOpen - 1); err != nil {
+			return nil, err
+		}
+		fm, err := NewFileManager(f.path, f.initialPages)
+		if err != nil {
+			return nil, fmt.Errorf("open file %d: %w", fileId, err)
+		}
+		f.fm = fm
+		fs.open.Add(1)
+	}
+	fs.inUse.Add(1)
+	f.refs.Add(1)
+	f.lastUsed.Store(fs.clock.Add(1))
+
+	return f, nil
+}
+
+// release ends a use of the file, closing files over the limit once idle.
+func (fs *FileSet) release(f *setFile) {
+	defer fs.inUse.Done()
+	if f.refs.Add(-1) > 0 || int(fs.open.Load()) <= fs.maxOpen {
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// A failed close leaves the file open, the next open retries
+	_ = fs.closeIdle(fs.maxOpen)
+}
+
+// closeIdle closes least recently used idle files until at most limit are
+// open, or none is idle. Caller must hold mu for writing.
+func (fs *FileSet) closeIdle(limit int) error {
+	for int(fs.open.Load()) > limit {
+		var victim *setFile
+		for _, f := range fs.files {
+			if f.fm == nil || f.refs.Load() != 0 {
+				continue
+			}
+			if victim == nil || f.lastUsed.Load() < victim.lastUsed.Load() {
+				victim = f
+			}
+		}
+		if victim == nil {
+			return nil // Every open file is in use
+		}
+
+		if err := victim.fm.Close(); err != nil {
+			return fmt.Errorf("close %s: %w", victim.path, err)
+		}
+		victim.fm = nil
+		fs.open.Add(-1)
+	}
+
+	return nil
+}
+
+func (fs *FileSet) ReadPage(pageId util.PageID) (*page.Page, error) {
+	f, err := fs.acquire(pageId.FileID())
+	if err != nil {
+		return nil, err
+	}
+	defer fs.release(f)
+
+	p, err := f.fm.ReadPage(pageId.PageNo())
+	if err != nil {
+		return nil, err
+	}
+	p.Header.PageID = pageId
+
+	return p, nil
+}
+
+// ReadPageInto reads the page into dst, see FileManager.ReadPageInto.
+func (fs *FileSet) ReadPageInto(pageId util.PageID, dst *page.Page) error {
+	f, err := fs.acquire(pageId.FileID())
+	if err != nil {
+		return err
+	}
+	defer fs.release(f)
+
+	if err := f.fm.ReadPageInto(pageId.PageNo(), dst); err != nil {
+		return err
+	}
+	dst.Header.PageID = pageId
+
+	return nil
+}
+
+// WritePage writes the page to its file under its page number. p is not
+// modified, a copy carries the file's page number.
+func (fs *FileSet) WritePage(p *page.Page) error {
+	pageId := p.Header.PageID
+	f, err := fs.acquire(pageId.FileID())
+	if err != nil {
+		return err
+	}
+	defer fs.release(f)
+
+	local := *p
+	local.Header.PageID = pageId.PageNo()
+	return f.fm.WritePage(&local)
+}
+
+// AllocatePage allocates a page in file 0.
+func (fs *FileSet) AllocatePage() (util.PageID, error) {
+	return fs.AllocatePageIn(0)
+}
+
+// AllocatePageIn allocates a page in the file. An empty page is written right
+// away: the file may be closed before the caller writes the page, and
+// reopening it must not hand the same page out again.
+func (fs *FileSet) AllocatePageIn(fileId util.FileID) (util.PageID, error) {
+	f, err := fs.acquire(fileId)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.release(f)
+
+	pageNo, err := f.fm.AllocatePage()
+	if err != nil {
+		return 0, err
+	}
+	if err := f.fm.WritePage(&page.Page{Header: page.PageHeader{PageID: pageNo}}); err != nil {
+		return 0, errors.Join(err, f.fm.DeallocatePage(pageNo))
+	}
+
+	return util.NewPageID(fileId, pageNo), nil
+}
+
+func (fs *FileSet) DeallocatePage(pageId util.PageID) error {
+	f, err := fs.acquire(pageId.FileID())
+	if err != nil {
+		return err
+	}
+	defer fs.release(f)
+
+	return f.fm.DeallocatePage(pageId.PageNo())
+}
+
+// WillNeed hints the pages of each file to the OS, see FileManager.WillNeed.
+func (fs *FileSet) WillNeed(pageIds []util.PageID) error {
+	byFile := make(map[util.FileID][]util.PageID)
+	for _, pageId := range pageIds {
+		byFile[pageId.FileID()] = append(byFile[pageId.FileID()], pageId.PageNo())
+	}
+
+	for fileId, pageNos := range byFile {
+		f, err := fs.acquire(fileId)
+		if err != nil {
+			return err
+		}
+		err = f.fm.WillNeed(pageNos)
+		fs.release(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sync flushes every open file. Closed files were synced when closed. The
+// files are only held open while syncing, so other files can be opened and
+// used meanwhile.
+func (fs *FileSet) Sync() error {
+	fs.mu.RLock()
+	var open []*setFile
+	for _, f := range fs.files {
+		if f.fm != nil && !fs.closed {
+			fs.inUse.Add(1)
+			f.refs.Add(1)
+			open = append(open, f)
+		}
+	}
+	fs.mu.RUnlock()
+
+	var errs []error
+	for _, f := range open {
+		errs = append(errs, f.fm.Sync())
+		fs.release(f)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes every open file once the reads and writes in flight are done.
+// Afterwards the set refuses any use.
+func (fs *FileSet) Close() error {
+	fs.mu.Lock()
+	if fs.closed {
+		fs.mu.Unlock()
+		return nil // Idempotent
+	}
+	fs.closed = true
+	fs.mu.Unlock()
+
+	// Uses are only acquired while open, so none starts after this
+	fs.inUse.Wait()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var errs []error
+	for _, f := range fs.files {
+		if f.fm != nil {
+			errs = append(errs, f.fm.Close())
+			f.fm = nil
+			fs.open.Add(-1)
+		}
+	}
+
+	return errors.Join(errs...)
+}
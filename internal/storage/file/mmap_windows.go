@@ -76,3 +76,44 @@ func munmap(fm *FileManager) error {
 
 	return err
 }
+
+// msync flushes the dirty pages of the mapped view to the file.
+func msync(fm *FileManager) error {
+	if fm.Data == nil {
+		return nil
+	}
+
+	addr := uintptr(unsafe.Pointer(&fm.Data[0]))
+	if err := syscall.FlushViewOfFile(addr, uintptr(len(fm.Data))); err != nil {
+		return os.NewSyscallError("FlushViewOfFile", err)
+	}
+	return nil
+}
+
+var procPrefetchVirtualMemory = syscall.NewLazyDLL("kernel32.dll").NewProc("PrefetchVirtualMemory")
+
+// memoryRangeEntry is WIN32_MEMORY_RANGE_ENTRY.
+type memoryRangeEntry struct {
+	VirtualAddress uintptr
+	NumberOfBytes  uintptr
+}
+
+// madviseWillNeed asks the memory manager to read the range of the view in,
+// the Windows counterpart of madvise(MADV_WILLNEED). It is a no-op before
+// Windows 8, which lacks PrefetchVirtualMemory.
+func madviseWillNeed(data []byte) error {
+	if len(data) == 0 || procPrefetchVirtualMemory.Find() != nil {
+		return nil
+	}
+
+	entry := memoryRangeEntry{
+		VirtualAddress: uintptr(unsafe.Pointer(&data[0])),
+		NumberOfBytes:  uintptr(len(data)),
+	}
+	process, _ := syscall.GetCurrentProcess()
+	r, _, e := procPrefetchVirtualMemory.Call(uintptr(process), 1, uintptr(unsafe.Pointer(&entry)), 0)
+	if r == 0 {
+		return os.NewSyscallError("PrefetchVirtualMemory", e)
+	}
+	return nil
+}
@@ -7,5 +7,18 @@ import (
 
 type Filer interface {
 	ReadPage(pageId utils.PageID) (*page.Page, error)
+	// ReadPageInto reads the page into a buffer the caller owns, such as a
+	// buffer pool frame. dst is left untouched on error.
+	ReadPageInto(pageId utils.PageID, dst *page.Page) error
 	WritePage(p *page.Page) error
 }
+
+// PageStore is the storage under a buffer pool: a single FileManager, or a
+// FileSet serving the pages of several files.
+type PageStore interface {
+	Filer
+	AllocatePage() (utils.PageID, error)
+	DeallocatePage(pageId utils.PageID) error
+	WillNeed(pageIds []utils.PageID) error
+	Sync() error
+}
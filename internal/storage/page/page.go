@@ -11,6 +11,7 @@ const (
 	HEADER_SIZE = 16 // Size of PageHeader struct: PageID(8) + Checksum(4) + Flags(2) + padding(2)
 	DIRTY_FLAG  = 1 << 0
 	PINNED_FLAG = 1 << 1
+	FREED_FLAG  = 1 << 2 // Only on double write copies, the page was deallocated
 )
 
 // Page is block that read/write from disk
@@ -46,31 +47,38 @@ func (p *Page) Serialize() []byte {
 
 // Deserialize unpacks from bytes, validates checksum
 func Deserialize(data []byte) (*Page, error) {
+	var page Page
+	if err := DeserializeInto(data, &page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// DeserializeInto is Deserialize into a page the caller owns. The checksum is
+// validated before dst is written, so dst is left untouched on error.
+func DeserializeInto(data []byte, dst *Page) error {
 	if len(data) != util.PageSize {
-		return nil, util.ErrInvalidPageSize
+		return util.ErrInvalidPageSize
 	}
 
 	// stored Checksum
 	pageChecksum := binary.LittleEndian.Uint32(data[8:12])
 
-	// calculated Checksum
-	checksumByte := make([]byte, 0)
-	checksumByte = append(checksumByte, data[0:8]...)
-	checksumByte = append(checksumByte, data[12:]...)
-	checksum := crc32.ChecksumIEEE(checksumByte)
+	// calculated Checksum, over PageID + Flags + Data
+	checksum := crc32.Update(crc32.ChecksumIEEE(data[0:8]), crc32.IEEETable, data[12:])
 
 	if checksum != pageChecksum {
-		return nil, util.ErrChecksumMismatch
+		return util.ErrChecksumMismatch
 	}
 
-	var page Page
-	page.Header.PageID = util.PageID(binary.LittleEndian.Uint64(data[0:8]))
-	page.Header.Checksum = checksum
-	page.Header.Flags = binary.LittleEndian.Uint16(data[12:14])
+	dst.Header.PageID = util.PageID(binary.LittleEndian.Uint64(data[0:8]))
+	dst.Header.Checksum = checksum
+	dst.Header.Flags = binary.LittleEndian.Uint16(data[12:14])
 
-	copy(page.Data[:], data[HEADER_SIZE:])
+	copy(dst.Data[:], data[HEADER_SIZE:])
 
-	return &page, nil
+	return nil
 }
 
 func (p *PageHeader) SetDirtyFlag() {
@@ -25,4 +25,28 @@ var (
 	ErrPageNotFound          = errors.New("page not found in buffer")
 	ErrPageMissed            = errors.New("page is missed")
 	ErrPageEvicted           = errors.New("page is being evicted")
+	ErrDoubleWriteSize       = errors.New("double write buffer size must be positive")
+	ErrDoubleWriteEnabled    = errors.New("double write buffer already enabled")
+	ErrBufferPoolClosed      = errors.New("buffer pool is closed")
+	ErrPagePinned            = errors.New("page is pinned")
+	ErrPageAlreadyFree       = errors.New("page is already free")
+	ErrInvalidLRUK           = errors.New("lru-k history size must be positive")
+	ErrUnknownReplacer       = errors.New("unknown replacer policy")
+	ErrInvalidShardCount     = errors.New("shard count must be positive")
+	ErrInvalidWaitSweeps     = errors.New("frame wait sweeps must be positive")
+	ErrInvalidWaitTimeout    = errors.New("frame wait timeout must be positive")
+	ErrInvalidBgWriter       = errors.New("background writer delay and page limit must be positive")
+	ErrBgWriterRunning       = errors.New("background writer is already running")
+	ErrBgWriterNotRunning    = errors.New("background writer is not running")
+	ErrInvalidReadAhead      = errors.New("read-ahead page limit must be positive")
+	ErrInvalidPinDebug       = errors.New("pin leak age must not be negative and needs a report func")
+	ErrPinDebugEnabled       = errors.New("pin debug mode already enabled")
+	ErrPinLeak               = errors.New("pages still pinned")
+	ErrPageWriteLatched      = errors.New("page is latched for writing")
+	ErrStaleHandle           = errors.New("frame handle is stale")
+	ErrInvalidFileId         = errors.New("invalid file id")
+	ErrUnknownFile           = errors.New("file is not registered")
+	ErrFileExists            = errors.New("file id already registered")
+	ErrInvalidMaxOpenFiles   = errors.New("max open files must be positive")
+	ErrFileSetClosed         = errors.New("file set is closed")
 )
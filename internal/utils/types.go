@@ -5,9 +5,34 @@ import (
 	"time"
 )
 
-// PageID represents a unique page identifier
+// PageID represents a unique page identifier. The top bits hold the FileID of
+// the file the page belongs to and the others its page number in the file, so
+// the pages of file 0 are numbered like a single file.
 type PageID uint64
 
+// FileID identifies one file of a file set, e.g. a table or an index file
+type FileID uint32
+
+const (
+	PAGE_NO_BITS = 40
+	MAX_FILE_ID  = 1<<(64-PAGE_NO_BITS) - 1
+)
+
+// NewPageID combines a file and a page number in that file
+func NewPageID(fileId FileID, pageNo PageID) PageID {
+	return PageID(fileId)<<PAGE_NO_BITS | pageNo&(1<<PAGE_NO_BITS-1)
+}
+
+// FileID returns the file the page belongs to
+func (id PageID) FileID() FileID {
+	return FileID(id >> PAGE_NO_BITS)
+}
+
+// PageNo returns the page number within its file
+func (id PageID) PageNo() PageID {
+	return id & (1<<PAGE_NO_BITS - 1)
+}
+
 // PageSize represents the standard page size (4KB) - > 4096 bytes
 const (
 	PageSize     = 4096
@@ -57,14 +82,32 @@ func NewDatabaseError(errType ErrorType, message string, cause error) *DatabaseE
 	}
 }
 
+// ReplacerPolicy selects the page replacement policy of the buffer pool
+type ReplacerPolicy int
+
+const (
+	ReplacerClock ReplacerPolicy = iota
+	ReplacerLRUK
+	ReplacerARC
+)
+
 // Options represents database configuration options
 type Options struct {
 	Path               string
 	PageSize           int
 	BufferPoolSize     int
+	BufferPoolShards   int // independent partitions of the buffer pool, each with its own lock
+	Replacer           ReplacerPolicy
+	ClockMaxLoop       int           // max usage count of a clock frame
+	LRUK               int           // accesses remembered per frame by LRU-K
+	FrameWaitSweeps    int           // sweeps finding every frame pinned before ErrNoFreeFrame
+	FrameWaitTimeout   time.Duration // longest wait for an unpin of a request without a deadline
+	BgWriterDelay      time.Duration // pause between background writer rounds
+	BgWriterMaxPages   int           // dirty pages written per background writer round
+	ReadAheadPages     int           // largest window prefetched ahead of a sequential scan
 	SyncWrites         bool
 	ReadOnly           bool
-	MaxOpenFiles       int
+	MaxOpenFiles       int // files of a file set kept open at once
 	CompactionInterval time.Duration
 }
 
@@ -73,6 +116,15 @@ func DefaultOptions() Options {
 	return Options{
 		PageSize:           PageSize,
 		BufferPoolSize:     1000, // 4MB default buffer pool
+		BufferPoolShards:   1,
+		Replacer:           ReplacerClock,
+		ClockMaxLoop:       3,
+		LRUK:               2,
+		FrameWaitSweeps:    4,
+		FrameWaitTimeout:   time.Second,
+		BgWriterDelay:      200 * time.Millisecond,
+		BgWriterMaxPages:   100,
+		ReadAheadPages:     32,
 		SyncWrites:         false,
 		ReadOnly:           false,
 		MaxOpenFiles:       1000,